@@ -10,7 +10,7 @@ import (
 
 func test1() {
 	utils.Logger.Println("TEST 1: WITHOUT MULTIBYTE CHARACTERS")
-	original, _ := utils.ReadFile("../../example.txt")
+	original, _, _ := utils.ReadFile("../../example.txt")
 	pt := ptm.NewPieceTable(
 		ptm.Sequence(original),
 	)
@@ -46,7 +46,7 @@ func test1() {
 
 func test2() {
 	utils.Logger.Println("TEST 2: WITH MULTIBYTE CHARACTERS")
-	original, _ := utils.ReadFile("../../example.txt")
+	original, _, _ := utils.ReadFile("../../example.txt")
 	pt := ptm.NewPieceTable(
 		ptm.Sequence(original),
 	)
@@ -71,7 +71,7 @@ func test2() {
 }
 
 func main() {
-	// original, _ := utils.ReadFile("../../example.txt")
+	// original, _, _ := utils.ReadFile("../../example.txt")
 	test1()
 	test2()
 
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Every action a key can do is a named command, and the keymap binds key chords to command names.
+// The defaults can be changed in keymap.json in the user's config directory, like
+//
+//	{
+//		"ctrl+k": "edit.deleteWordRight",
+//		"ctrl+y": ""
+//	}
+//
+// where an empty command removes the binding.
+
+// @commands
+type Command struct {
+	Name   string
+	Run    func(w *Window)
+	Repeat bool // keeps running while the key is held, see KeyRepeat
+}
+
+type Commands map[string]Command
+
+func (c Commands) Register(name string, repeat bool, run func(w *Window)) {
+	c[name] = Command{Name: name, Run: run, Repeat: repeat}
+}
+
+// a cursor movement, as cursor.name and as select.name, which extends the selection
+type movement struct {
+	name string
+	move func(e *Editor)
+	// every cursor would scroll or end up at the same place, so only the main one is kept
+	mainCursorOnly bool
+}
+
+var MOVEMENTS = []movement{
+	{"right", (*Editor).MoveCursorForward, false},
+	{"left", (*Editor).MoveCursorBackward, false},
+	{"up", (*Editor).MoveCursorUpward, false},
+	{"down", (*Editor).MoveCursorDownward, false},
+	{"wordRight", (*Editor).MoveWordForward, false},
+	{"wordLeft", (*Editor).MoveWordBackward, false},
+	{"lineStart", (*Editor).MoveToLineStart, false},
+	{"lineEnd", (*Editor).MoveToLineEnd, false},
+	{"paragraphStart", (*Editor).MoveToParagraphStart, false},
+	{"paragraphEnd", (*Editor).MoveToParagraphEnd, false},
+	{"pageUp", (*Editor).PageUp, true},
+	{"pageDown", (*Editor).PageDown, true},
+	{"textStart", (*Editor).MoveToTextStart, true},
+	{"textEnd", (*Editor).MoveToTextEnd, true},
+}
+
+func NewCommands() Commands {
+	commands := make(Commands)
+	for _, m := range MOVEMENTS {
+		for _, extend := range []bool{false, true} {
+			name := "cursor." + m.name
+			if extend {
+				name = "select." + m.name
+			}
+			commands.Register(name, true, func(w *Window) {
+				if m.mainCursorOnly {
+					w.Editor.ClearExtraCursors()
+				}
+				w.Editor.MoveCursor(func() { m.move(w.Editor) }, extend)
+			})
+		}
+	}
+
+	commands.Register("select.all", false, func(w *Window) { w.Editor.SelectAll() })
+	commands.Register("select.nextOccurrence", false, func(w *Window) { w.Editor.SelectNextOccurrence() })
+
+	commands.Register("edit.backspace", true, func(w *Window) { w.Editor.Backspace() })
+	commands.Register("edit.delete", true, func(w *Window) { w.Editor.DeleteForward() })
+	commands.Register("edit.deleteWordLeft", true, func(w *Window) { w.Editor.DeleteWordBackward() })
+	commands.Register("edit.deleteWordRight", true, func(w *Window) { w.Editor.DeleteWordForward() })
+	commands.Register("edit.newLine", true, func(w *Window) { w.Editor.InsertNewLine() })
+	commands.Register("edit.tab", true, func(w *Window) { w.Editor.InsertTab() })
+	commands.Register("edit.undo", true, func(w *Window) { w.Editor.Undo() })
+	commands.Register("edit.redo", true, func(w *Window) { w.Editor.Redo() })
+	commands.Register("edit.copy", false, func(w *Window) {
+		err := w.Editor.Copy()
+		if err != nil {
+			w.ShowMessage(err.Error())
+		}
+	})
+	commands.Register("edit.cut", false, func(w *Window) {
+		err := w.Editor.Cut()
+		if err != nil {
+			w.ShowMessage(err.Error())
+		}
+	})
+	commands.Register("edit.paste", false, func(w *Window) { w.Editor.Paste() })
+
+	commands.Register("file.save", false, func(w *Window) { w.Save() })
+	commands.Register("file.saveAs", false, func(w *Window) { w.SaveAs() })
+	commands.Register("file.lineEnding", false, func(w *Window) { w.ChangeLineEnding() })
+
+	commands.Register("view.theme", false, func(w *Window) { w.ChangeTheme() })
+
+	// writes the text and the typed keys to output/ and quits, it isn't bound by default
+	commands.Register("debug.dumpAndExit", false, func(w *Window) {
+		OutputText(*w.Editor.PieceTable)
+		OutputKeys()
+		os.Exit(1)
+	})
+	return commands
+}
+
+// @keymap
+type KeyChord struct {
+	Key                 int32
+	Control, Shift, Alt bool
+}
+
+var KEY_NAMES = map[string]int32{
+	"right":        rl.KeyRight,
+	"left":         rl.KeyLeft,
+	"up":           rl.KeyUp,
+	"down":         rl.KeyDown,
+	"pageup":       rl.KeyPageUp,
+	"pagedown":     rl.KeyPageDown,
+	"home":         rl.KeyHome,
+	"end":          rl.KeyEnd,
+	"backspace":    rl.KeyBackspace,
+	"delete":       rl.KeyDelete,
+	"insert":       rl.KeyInsert,
+	"enter":        rl.KeyEnter,
+	"kpenter":      rl.KeyKpEnter,
+	"tab":          rl.KeyTab,
+	"space":        rl.KeySpace,
+	"escape":       rl.KeyEscape,
+	"apostrophe":   rl.KeyApostrophe,
+	"comma":        rl.KeyComma,
+	"minus":        rl.KeyMinus,
+	"period":       rl.KeyPeriod,
+	"slash":        rl.KeySlash,
+	"semicolon":    rl.KeySemicolon,
+	"equal":        rl.KeyEqual,
+	"leftbracket":  rl.KeyLeftBracket,
+	"rightbracket": rl.KeyRightBracket,
+	"backslash":    rl.KeyBackSlash,
+	"grave":        rl.KeyGrave,
+}
+
+func init() {
+	for i := range int32(26) {
+		KEY_NAMES[string(rune('a'+i))] = rl.KeyA + i
+	}
+	for i := range int32(10) {
+		KEY_NAMES[string(rune('0'+i))] = rl.KeyZero + i
+	}
+	for i := range int32(12) {
+		KEY_NAMES[fmt.Sprintf("f%d", i+1)] = rl.KeyF1 + i
+	}
+}
+
+// parses chords like "ctrl+shift+z", the key goes last
+func ParseKeyChord(text string) (KeyChord, error) {
+	chord := KeyChord{}
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(text)), "+")
+	for _, modifier := range parts[:len(parts)-1] {
+		switch strings.TrimSpace(modifier) {
+		case "ctrl", "control":
+			chord.Control = true
+		case "shift":
+			chord.Shift = true
+		case "alt":
+			chord.Alt = true
+		default:
+			return KeyChord{}, fmt.Errorf("ParseKeyChord: unknown modifier %q in %q", modifier, text)
+		}
+	}
+	key, ok := KEY_NAMES[strings.TrimSpace(parts[len(parts)-1])]
+	if !ok {
+		return KeyChord{}, fmt.Errorf("ParseKeyChord: unknown key %q in %q", parts[len(parts)-1], text)
+	}
+	chord.Key = key
+	return chord, nil
+}
+
+type Keymap map[KeyChord]string
+
+var DEFAULT_KEYMAP = map[string]string{
+	"right":            "cursor.right",
+	"left":             "cursor.left",
+	"up":               "cursor.up",
+	"down":             "cursor.down",
+	"ctrl+right":       "cursor.wordRight",
+	"ctrl+left":        "cursor.wordLeft",
+	"home":             "cursor.lineStart",
+	"end":              "cursor.lineEnd",
+	"alt+home":         "cursor.paragraphStart",
+	"alt+end":          "cursor.paragraphEnd",
+	"pageup":           "cursor.pageUp",
+	"pagedown":         "cursor.pageDown",
+	"ctrl+home":        "cursor.textStart",
+	"ctrl+end":         "cursor.textEnd",
+	"shift+right":      "select.right",
+	"shift+left":       "select.left",
+	"shift+up":         "select.up",
+	"shift+down":       "select.down",
+	"ctrl+shift+right": "select.wordRight",
+	"ctrl+shift+left":  "select.wordLeft",
+	"shift+home":       "select.lineStart",
+	"shift+end":        "select.lineEnd",
+	"alt+shift+home":   "select.paragraphStart",
+	"alt+shift+end":    "select.paragraphEnd",
+	"shift+pageup":     "select.pageUp",
+	"shift+pagedown":   "select.pageDown",
+	"ctrl+shift+home":  "select.textStart",
+	"ctrl+shift+end":   "select.textEnd",
+	"ctrl+a":           "select.all",
+	"ctrl+d":           "select.nextOccurrence",
+	"backspace":        "edit.backspace",
+	"shift+backspace":  "edit.backspace",
+	"delete":           "edit.delete",
+	"ctrl+backspace":   "edit.deleteWordLeft",
+	"ctrl+delete":      "edit.deleteWordRight",
+	"enter":            "edit.newLine",
+	"shift+enter":      "edit.newLine",
+	"kpenter":          "edit.newLine",
+	"tab":              "edit.tab",
+	"ctrl+z":           "edit.undo",
+	"ctrl+shift+z":     "edit.redo",
+	"ctrl+y":           "edit.redo",
+	"ctrl+c":           "edit.copy",
+	"ctrl+x":           "edit.cut",
+	"ctrl+v":           "edit.paste",
+	"ctrl+s":           "file.save",
+	"ctrl+shift+s":     "file.saveAs",
+	"ctrl+shift+l":     "file.lineEnding",
+	"ctrl+shift+t":     "view.theme",
+}
+
+func DefaultKeymap(commands Commands) Keymap {
+	keymap := make(Keymap)
+	err := keymap.Apply(DEFAULT_KEYMAP, commands)
+	if err != nil {
+		// the defaults are ours, a mistake in them is a bug
+		panic(err)
+	}
+	return keymap
+}
+
+// binds every chord in bindings to its command, an empty command unbinds the chord.
+// Bindings with errors are skipped, the errors are returned together
+func (k Keymap) Apply(bindings map[string]string, commands Commands) error {
+	var errs []error
+	for text, name := range bindings {
+		chord, err := ParseKeyChord(text)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if name == "" {
+			delete(k, chord)
+			continue
+		}
+		if _, ok := commands[name]; !ok {
+			errs = append(errs, fmt.Errorf("Keymap: unknown command %q for %q", name, text))
+			continue
+		}
+		k[chord] = name
+	}
+	return errors.Join(errs...)
+}
+
+// the default keymap with the bindings in path on top, a missing file just means no changes
+func LoadKeymap(path string, commands Commands) (Keymap, error) {
+	keymap := DefaultKeymap(commands)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keymap, nil
+	}
+	if err != nil {
+		return keymap, fmt.Errorf("LoadKeymap: error trying to read %s: %w", path, err)
+	}
+	bindings := map[string]string{}
+	err = json.Unmarshal(content, &bindings)
+	if err != nil {
+		return keymap, fmt.Errorf("LoadKeymap: error trying to parse %s: %w", path, err)
+	}
+	return keymap, keymap.Apply(bindings, commands)
+}
+
+// the distinct keys of the keymap, sorted so they are checked in the same order every frame
+func (k Keymap) Keys() []int32 {
+	keys := make([]int32, 0, len(k))
+	for chord := range k {
+		if !slices.Contains(keys, chord.Key) {
+			keys = append(keys, chord.Key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (w *Window) SetKeymap(keymap Keymap) {
+	w.Keymap = keymap
+	w.keymapKeys = keymap.Keys()
+}
+
+// Runs the commands bound to the keys pressed this frame with exactly the modifiers held.
+// Every key goes through KeyRepeat once, a repeat only runs the commands that allow it
+func (w *Window) RunKeymap() {
+	modifiers := KeyChord{Control: IsControlDown(), Shift: IsShiftDown(), Alt: IsAltDown()}
+	for _, key := range w.keymapKeys {
+		pressed := rl.IsKeyPressed(key)
+		repeated := w.KeyRepeat.IsKeyPressed(key)
+		if !repeated {
+			continue
+		}
+		chord := modifiers
+		chord.Key = key
+		name, ok := w.Keymap[chord]
+		if !ok {
+			continue
+		}
+		command := w.Commands[name]
+		if pressed || command.Repeat {
+			command.Run(w)
+		}
+	}
+}
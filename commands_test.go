@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestParseKeyChord(t *testing.T) {
+	cases := []struct {
+		text  string
+		want  KeyChord
+		valid bool
+	}{
+		{"a", KeyChord{Key: rl.KeyA}, true},
+		{"ctrl+z", KeyChord{Key: rl.KeyZ, Control: true}, true},
+		{"control+shift+z", KeyChord{Key: rl.KeyZ, Control: true, Shift: true}, true},
+		{"alt+shift+home", KeyChord{Key: rl.KeyHome, Shift: true, Alt: true}, true},
+		{"Ctrl+Shift+Right", KeyChord{Key: rl.KeyRight, Control: true, Shift: true}, true},
+		{" ctrl + s ", KeyChord{Key: rl.KeyS, Control: true}, true},
+		{"f12", KeyChord{Key: rl.KeyF12}, true},
+		{"ctrl+0", KeyChord{Key: rl.KeyZero, Control: true}, true},
+		{"shift+kpenter", KeyChord{Key: rl.KeyKpEnter, Shift: true}, true},
+		{"", KeyChord{}, false},
+		{"ctrl+", KeyChord{}, false}, // the key is empty
+		{"+a", KeyChord{}, false},    // so is the modifier
+		{"ctrl", KeyChord{}, false},  // a modifier isn't a key
+		{"super+a", KeyChord{}, false},
+		{"ctrl+nokey", KeyChord{}, false},
+		{"a+ctrl", KeyChord{}, false}, // the key goes last
+	}
+	for _, c := range cases {
+		got, err := ParseKeyChord(c.text)
+		if c.valid && err != nil {
+			t.Errorf("ParseKeyChord(%q): %v", c.text, err)
+			continue
+		}
+		if !c.valid && err == nil {
+			t.Errorf("ParseKeyChord(%q) is %+v, want an error", c.text, got)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseKeyChord(%q) is %+v, want %+v", c.text, got, c.want)
+		}
+	}
+}
+
+func TestKeymapApply(t *testing.T) {
+	commands := NewCommands()
+	undo := KeyChord{Key: rl.KeyZ, Control: true}
+	redo := KeyChord{Key: rl.KeyY, Control: true}
+	cases := []struct {
+		name     string
+		bindings map[string]string
+		valid    bool
+		chord    KeyChord
+		want     string // the command bound to chord after Apply, empty when it's unbound
+	}{
+		{"a new binding", map[string]string{"ctrl+k": "edit.deleteWordRight"}, true, KeyChord{Key: rl.KeyK, Control: true}, "edit.deleteWordRight"},
+		{"a binding that replaces a default", map[string]string{"ctrl+z": "edit.redo"}, true, undo, "edit.redo"},
+		{"an empty command unbinds", map[string]string{"ctrl+y": ""}, true, redo, ""},
+		{"unbinding a chord that isn't bound", map[string]string{"ctrl+k": ""}, true, KeyChord{Key: rl.KeyK, Control: true}, ""},
+		{"an unknown command is rejected", map[string]string{"ctrl+z": "edit.nothing"}, false, undo, "edit.undo"},
+		{"an unknown chord is rejected", map[string]string{"ctrl+nokey": "edit.undo"}, false, undo, "edit.undo"},
+		{"the valid bindings are kept when others fail", map[string]string{"ctrl+y": "", "ctrl+": "edit.undo"}, false, redo, ""},
+	}
+	for _, c := range cases {
+		keymap := DefaultKeymap(commands)
+		err := keymap.Apply(c.bindings, commands)
+		if c.valid && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: no error", c.name)
+		}
+		if got := keymap[c.chord]; got != c.want {
+			t.Errorf("%s: %+v is bound to %q, want %q", c.name, c.chord, got, c.want)
+		}
+	}
+}
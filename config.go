@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// The editor settings come from config.json in the user's config directory, next to keymap.json, like
+//
+//	{
+//		"font": "/usr/share/fonts/TTF/FiraCode-Regular.ttf",
+//		"fontSize": 24,
+//		"theme": "light"
+//	}
+//
+// Settings that are missing keep their default value, and so do the ones that are invalid,
+// which are reported. The file is read again whenever it changes while the editor is open.
+
+// @config
+const (
+	CONFIG_DIR           = "text-editor"
+	CONFIG_POLL_INTERVAL = 1.0 // seconds between checks for changes in the config file
+)
+
+// Common fonts with the scripts and symbols JetBrains Mono doesn't have, the ones found are the default fallbacks.
+// raylib can't load .ttc collections, which is how many CJK fonts come
+var DEFAULT_FALLBACK_FONTS = []string{
+	// windows
+	"C:/Windows/Fonts/seguisym.ttf",
+	"C:/Windows/Fonts/simhei.ttf",
+	"C:/Windows/Fonts/malgun.ttf",
+	"C:/Windows/Fonts/arialuni.ttf",
+	// linux
+	"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
+	"/usr/share/fonts/TTF/DejaVuSans.ttf",
+	"/usr/share/fonts/truetype/droid/DroidSansFallbackFull.ttf",
+	"/usr/share/fonts/truetype/noto/NotoSansSymbols2-Regular.ttf",
+	// macos
+	"/System/Library/Fonts/Supplemental/Arial Unicode.ttf",
+	"/Library/Fonts/Arial Unicode.ttf",
+}
+
+func existingFiles(paths []string) []string {
+	existing := []string{}
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		if err == nil {
+			existing = append(existing, path)
+		}
+	}
+	return existing
+}
+
+// where name goes inside the user's config directory
+func ConfigPath(name string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, CONFIG_DIR, name), nil
+}
+
+// where the custom themes are, empty without a config directory
+func ThemesDir() string {
+	dir, _ := ConfigPath("themes")
+	return dir
+}
+
+type Config struct {
+	Font           string   `json:"font"`
+	FallbackFonts  []string `json:"fallbackFonts"` // for the chars Font doesn't have, the first one that has the char is used
+	FontSize       int      `json:"fontSize"`
+	CharSpacing    float32  `json:"charSpacing"`
+	Monospace      bool     `json:"monospace"`    // chars take one cell of the same width, or two for the wide ones
+	TabWidth       int      `json:"tabWidth"`     // spaces between tab stops
+	InsertSpaces   bool     `json:"insertSpaces"` // the Tab key inserts spaces instead of a tab
+	LinesXPadding  float32  `json:"linesPadding"`
+	Theme          string   `json:"theme"` // a builtin theme, one in the themes directory or a path to a theme file
+	Width          int32    `json:"width"`
+	Height         int32    `json:"height"`
+	FPS            int32    `json:"fps"`
+	ScrollLines    float32  `json:"scrollLines"` // lines scrolled per mouse wheel step
+	KeyRepeatDelay float32  `json:"keyRepeatDelay"`
+	KeyRepeatRate  float32  `json:"keyRepeatRate"`
+	theme          Theme    // found by Validate
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Font:           "fonts/JetBrainsMono-Regular.ttf",
+		FallbackFonts:  existingFiles(DEFAULT_FALLBACK_FONTS),
+		FontSize:       30,
+		CharSpacing:    0,
+		Monospace:      true,
+		TabWidth:       4,
+		InsertSpaces:   false,
+		LinesXPadding:  15,
+		Theme:          DARK_THEME.Name,
+		theme:          DARK_THEME,
+		Width:          1600,
+		Height:         900,
+		FPS:            60,
+		ScrollLines:    3,
+		KeyRepeatDelay: KEY_REPEAT_DELAY,
+		KeyRepeatRate:  KEY_REPEAT_RATE,
+	}
+}
+
+// Every invalid setting goes back to its default value, the errors are returned together
+func (c *Config) Validate() error {
+	defaults := DefaultConfig()
+	var errs []error
+	check := func(valid bool, name string, reset func()) {
+		if !valid {
+			errs = append(errs, fmt.Errorf("Config: invalid %s", name))
+			reset()
+		}
+	}
+	_, err := os.Stat(c.Font)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("Config: error trying to find the font: %w", err))
+		c.Font = defaults.Font
+	}
+	fallbacks := []string{}
+	for _, path := range c.FallbackFonts {
+		_, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Config: error trying to find a fallback font: %w", err))
+			continue
+		}
+		fallbacks = append(fallbacks, path)
+	}
+	c.FallbackFonts = fallbacks
+	theme, err := FindTheme(c.Theme, ThemesDir())
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if theme.Name == "" {
+		c.Theme = defaults.Theme
+		theme = defaults.theme
+	}
+	c.theme = theme
+	check(c.FontSize >= 6 && c.FontSize <= 200, "fontSize, it goes from 6 to 200", func() { c.FontSize = defaults.FontSize })
+	check(c.CharSpacing >= 0, "charSpacing, it can't be negative", func() { c.CharSpacing = defaults.CharSpacing })
+	check(c.TabWidth >= 1 && c.TabWidth <= 16, "tabWidth, it goes from 1 to 16", func() { c.TabWidth = defaults.TabWidth })
+	check(c.LinesXPadding >= 0, "linesPadding, it can't be negative", func() { c.LinesXPadding = defaults.LinesXPadding })
+	check(c.Width >= 200 && c.Height >= 200, "width or height, the window is at least 200x200", func() {
+		c.Width = defaults.Width
+		c.Height = defaults.Height
+	})
+	check(c.FPS > 0, "fps, it must be positive", func() { c.FPS = defaults.FPS })
+	check(c.ScrollLines > 0, "scrollLines, it must be positive", func() { c.ScrollLines = defaults.ScrollLines })
+	check(c.KeyRepeatDelay >= 0, "keyRepeatDelay, it can't be negative", func() { c.KeyRepeatDelay = defaults.KeyRepeatDelay })
+	check(c.KeyRepeatRate >= 0, "keyRepeatRate, it can't be negative, 0 turns the repeat off", func() { c.KeyRepeatRate = defaults.KeyRepeatRate })
+	return errors.Join(errs...)
+}
+
+// The default config with the settings in path on top, a missing file just means no changes.
+// The config is usable even when there's an error
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("LoadConfig: error trying to read %s: %w", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&config)
+	if err != nil {
+		// a half decoded file could have anything, so none of it is used
+		return DefaultConfig(), fmt.Errorf("LoadConfig: error trying to parse %s: %w", path, err)
+	}
+	return config, config.Validate()
+}
+
+// tells when the config file changed, checking its modification time every CONFIG_POLL_INTERVAL
+type ConfigWatcher struct {
+	Path      string
+	modTime   time.Time
+	lastCheck float64
+}
+
+func NewConfigWatcher(path string) ConfigWatcher {
+	watcher := ConfigWatcher{Path: path}
+	watcher.modTime = watcher.currentModTime()
+	return watcher
+}
+
+// a missing file has the zero time, so creating or deleting the file counts as a change too
+func (c *ConfigWatcher) currentModTime() time.Time {
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (c *ConfigWatcher) Changed() bool {
+	if c.Path == "" || rl.GetTime()-c.lastCheck < CONFIG_POLL_INTERVAL {
+		return false
+	}
+	c.lastCheck = rl.GetTime()
+	modTime := c.currentModTime()
+	if modTime.Equal(c.modTime) {
+		return false
+	}
+	c.modTime = modTime
+	return true
+}
+
+// @applying the config
+// Loads the font and the fallback fonts at the config's size, raylib bakes the glyphs at one size
+// so a new size needs new fonts. The previous fonts stay if the main one can't be loaded,
+// a fallback font that can't be loaded is skipped
+func (w *Window) LoadFonts(config Config) error {
+	glyphs, err := NewGlyphAtlas(config.Font, config.FontSize)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	fallbacks := []*GlyphAtlas{}
+	for _, path := range config.FallbackFonts {
+		fallback, err := NewGlyphAtlas(path, config.FontSize)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	w.UnloadFonts()
+	w.glyphs = glyphs
+	w.fallbacks = fallbacks
+	w.Editor.SetFonts(glyphs, fallbacks)
+	return errors.Join(errs...)
+}
+
+func (w *Window) UnloadFonts() {
+	if w.glyphs != nil {
+		w.glyphs.Unload()
+	}
+	for _, fallback := range w.fallbacks {
+		fallback.Unload()
+	}
+	w.glyphs = nil
+	w.fallbacks = nil
+}
+
+// Applies config to the window and the editor, only reloading the font and resizing when they changed
+func (w *Window) ApplyConfig(config Config) error {
+	var err error
+	previous := w.Config
+	w.Config = config
+	fontsChanged := config.Font != previous.Font || config.FontSize != previous.FontSize || !slices.Equal(config.FallbackFonts, previous.FallbackFonts)
+	if w.glyphs == nil || fontsChanged {
+		err = w.LoadFonts(config)
+	}
+	if config.FPS != previous.FPS {
+		rl.SetTargetFPS(config.FPS)
+	}
+	if config.Width != w.Width || config.Height != w.Height {
+		w.Width = config.Width
+		w.Height = config.Height
+		rl.SetWindowSize(int(w.Width), int(w.Height))
+	}
+	w.KeyRepeat.Delay = config.KeyRepeatDelay
+	w.KeyRepeat.Rate = config.KeyRepeatRate
+
+	// without a font the editor keeps raylib's default one
+	e := w.Editor
+	rectangle := rl.NewRectangle(0, 0, float32(w.Width), float32(w.Height))
+	// the lines are wrapped again only when something they're measured with changed
+	layoutChanged := fontsChanged || config.FontSize != e.FontSize || config.CharSpacing != e.CharSpacing ||
+		config.Monospace != e.Monospace || config.TabWidth != e.TabWidth || config.LinesXPadding != e.LinesXPadding
+	e.SetFontSize(config.FontSize)
+	e.CharSpacing = config.CharSpacing
+	e.Monospace = config.Monospace
+	e.TabWidth = config.TabWidth
+	e.InsertSpaces = config.InsertSpaces
+	e.LinesXPadding = config.LinesXPadding
+	e.SetTheme(config.theme)
+	e.ScrollSpeed = float32(config.FontSize) * config.ScrollLines
+	if rectangle != e.EditorRec {
+		e.Resize(rectangle)
+	} else if layoutChanged {
+		e.Relayout()
+	}
+	return err
+}
+
+// reads the config again when its file changed, errors are shown like any other message
+func (w *Window) ReloadConfig() {
+	if !w.configWatcher.Changed() {
+		return
+	}
+	config, err := LoadConfig(w.configWatcher.Path)
+	err = errors.Join(err, w.ApplyConfig(config))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "text-editor:", err)
+		w.ShowMessage("config: some settings have errors, see the terminal")
+		return
+	}
+	w.ShowMessage("config reloaded")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// every invalid setting goes back to its default, the valid ones are kept
+func TestConfigValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(c *Config)
+		valid  bool
+		want   func(c *Config) // the config after Validate, starting from the default one
+	}{
+		{"the defaults", func(c *Config) {}, true, func(c *Config) {}},
+		{"a font size in range", func(c *Config) { c.FontSize = 6 }, true, func(c *Config) { c.FontSize = 6 }},
+		{"a font size too small", func(c *Config) { c.FontSize = 5 }, false, func(c *Config) {}},
+		{"a font size too big", func(c *Config) { c.FontSize = 201 }, false, func(c *Config) {}},
+		{"a negative char spacing", func(c *Config) { c.CharSpacing = -1 }, false, func(c *Config) {}},
+		{"the widest tab", func(c *Config) { c.TabWidth = 16 }, true, func(c *Config) { c.TabWidth = 16 }},
+		{"a tab of no spaces", func(c *Config) { c.TabWidth = 0 }, false, func(c *Config) {}},
+		{"a tab too wide", func(c *Config) { c.TabWidth = 17 }, false, func(c *Config) {}},
+		{"a negative padding", func(c *Config) { c.LinesXPadding = -3 }, false, func(c *Config) {}},
+		{"the smallest window", func(c *Config) { c.Width, c.Height = 200, 200 }, true, func(c *Config) { c.Width, c.Height = 200, 200 }},
+		{"a window too short resets both sides", func(c *Config) { c.Width, c.Height = 800, 100 }, false, func(c *Config) {}},
+		{"no fps", func(c *Config) { c.FPS = 0 }, false, func(c *Config) {}},
+		{"no scroll", func(c *Config) { c.ScrollLines = 0 }, false, func(c *Config) {}},
+		{"no key repeat", func(c *Config) { c.KeyRepeatRate = 0 }, true, func(c *Config) { c.KeyRepeatRate = 0 }},
+		{"a negative key repeat delay", func(c *Config) { c.KeyRepeatDelay = -1 }, false, func(c *Config) {}},
+		{"a font that doesn't exist", func(c *Config) { c.Font = "fonts/missing.ttf" }, false, func(c *Config) {}},
+		{"a fallback font that doesn't exist is dropped", func(c *Config) {
+			c.FallbackFonts = []string{"fonts/missing.ttf", "fonts/JetBrainsMono-Regular.ttf"}
+		}, false, func(c *Config) { c.FallbackFonts = []string{"fonts/JetBrainsMono-Regular.ttf"} }},
+		{"a builtin theme in any case", func(c *Config) { c.Theme = "LIGHT" }, true, func(c *Config) {
+			c.Theme = "LIGHT"
+			c.theme = LIGHT_THEME
+		}},
+		{"an unknown theme", func(c *Config) { c.Theme = "missing/theme.json" }, false, func(c *Config) {}},
+		{"every error at once", func(c *Config) {
+			c.FontSize = 0
+			c.TabWidth = 0
+			c.FPS = -1
+		}, false, func(c *Config) {}},
+	}
+	for _, c := range cases {
+		config := DefaultConfig()
+		c.change(&config)
+		err := config.Validate()
+		if c.valid && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: no error", c.name)
+		}
+		want := DefaultConfig()
+		c.want(&want)
+		if !reflect.DeepEqual(config, want) {
+			t.Errorf("%s: the config is\n%+v\nwant\n%+v", c.name, config, want)
+		}
+	}
+}
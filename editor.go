@@ -3,8 +3,17 @@ package main
 // remember: moving cursor horizontally/mouse clicking/inserting/deleting invalidates the LastCursorPosition from lines
 
 import (
+	"bytes"
 	"fmt"
+	"iter"
+	"maps"
+	"math"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	pt "main/piece-table"
 	"main/utils"
@@ -38,6 +47,8 @@ type Line struct {
 	Start, Length int
 	Rectangle     rl.Rectangle
 	AutoNewLine   bool
+	ParagraphX    float32 // where the line starts after its paragraph's start, its tab stops are counted from there
+	Ascent        float32 // from the line's top to the baseline its chars are drawn on
 }
 
 // @cursor
@@ -72,12 +83,12 @@ func (c *Cursor) SetPosition(currentIndex int, x float32, y float32, line int, c
 // TODO: Try to think of another approach to prevent the cursor from overlapping a char.
 // Try += charWidth+offset and -= charWidth+offset later.
 const CURSOR_OFFSET_X = 0.0 // offset to prevent cursor overlap with text. maybe try another approach later.
-func (c *Cursor) Draw() {
+func (c *Cursor) Draw(scrollY float32) {
 	c.TickTimer += rl.GetFrameTime()
 	// if c.TickTimer > c.TickTime {
 	rl.DrawRectangle(
 		c.Rectangle.ToInt32().X-CURSOR_OFFSET_X,
-		c.Rectangle.ToInt32().Y,
+		int32(c.Rectangle.Y-scrollY),
 		c.Rectangle.ToInt32().Width,
 		c.Rectangle.ToInt32().Height,
 		c.Color,
@@ -88,6 +99,37 @@ func (c *Cursor) Draw() {
 	}
 }
 
+// Anchor is where the selection started and Head is where the cursor is, both are rune offsets.
+// Head can be before Anchor when selecting backwards
+type Selection struct {
+	Anchor, Head int
+}
+
+func (s Selection) Start() int {
+	return min(s.Anchor, s.Head)
+}
+
+func (s Selection) End() int {
+	return max(s.Anchor, s.Head)
+}
+
+func (s Selection) Length() int {
+	return s.End() - s.Start()
+}
+
+func (s Selection) IsEmpty() bool {
+	return s.Anchor == s.Head
+}
+
+// the state of a cursor other than the main one, the main one lives in the Editor's own fields
+type ExtraCursor struct {
+	Cursor              Cursor
+	Selection           Selection
+	PreviousCharacter   rune
+	LastLineVisited     int
+	LastCursorPositions map[int]CursorPosition
+}
+
 type Action = int
 
 const (
@@ -98,58 +140,91 @@ const (
 	MOUSE_LEFT_CLICK
 )
 
+// seconds without typing or deleting before the next edit starts a new undo step
+const UNDO_GROUP_PAUSE = 1.0
+
+const SCROLLBAR_WIDTH = 10
+
+// how much of the distance between the mouse and the editor's edge is scrolled every frame while drag selecting
+const DRAG_SCROLL_FACTOR = 0.2
+
 // @editor
 type Editor struct {
 	CharRecCache        map[rune]rl.Vector2
 	EditorRec           rl.Rectangle
 	WritableRec         rl.Rectangle
-	BackgroundColor     rl.Color
+	Theme               Theme
 	Cursor              Cursor
+	Selection           Selection // empty when nothing is selected, its values only matter when it isn't
+	ExtraCursors        []ExtraCursor
 	Lines               []*Line
 	LastCursorPositions map[int]CursorPosition
 	PieceTable          *pt.PieceTable
 	Font                *rl.Font
+	Monospace           bool          // every cluster takes whole cells of the same width, see CharWidthWithSpacing
+	Glyphs              *GlyphAtlas   // grows Font's atlas with the chars inserted, without it Font is used as it is
+	Fallbacks           []*GlyphAtlas // tried in order for the chars Glyphs' font doesn't have
+	atlasCache          map[rune]*GlyphAtlas
+	visualLines         map[*Line][]pt.VisualCluster // see VisualClusters
+	bidiParagraphs      map[*Line]paragraphLevels    // by the paragraph's first line, see paragraphLevelsOf
 	FontSize            int
-	FontColor           rl.Color
 	PreviousCharacter   rune
 	LastLineVisited     int
 	Actions             []Action
 	LinesXPadding       float32
 	CharSpacing         float32
+	TabWidth            int  // spaces between tab stops
+	InsertSpaces        bool // the Tab key inserts spaces up to the next tab stop instead of a tab
 	InFocus             bool
 	ShowLines           bool
 	linesMaxVec         rl.Vector2
 	renderTexture       rl.RenderTexture2D
+	ScrollY             float32 // how far down the text is scrolled, lines keep their position on the whole text
+	ScrollSpeed         float32 // pixels scrolled per mouse wheel step
+	scrollbarDragging   bool
+	scrollbarGrabY      float32 // where the scrollbar thumb was grabbed, relative to its top
+	selecting           bool    // the mouse is being dragged to select text
+	lastDragMouse       rl.Vector2
+	renderPaused        bool // set while many cursors change at once, so the text is drawn only once at the end
+	renderPending       bool
+	FilePath            string        // where the text came from and where it will be saved, empty if it was never saved
+	LineEnding          pt.LineEnding // how the typed and pasted line breaks are written, see @line endings
+	savedLineEnding     pt.LineEnding
+	lineEndingChanges   map[int][2]pt.LineEnding // the line endings before and after each change of it, by transaction ID
+	lastActionTime      float64
+	lastEditIndex       int  // where the cursor was left by the last Insert/Delete
+	lastTypedChar       rune // used to break the undo group when a new word starts
+	typingGroupOpen     bool // AddAction opened the undo group that is open now, only the editor closes it
 }
 
-func NewEditor(rectangle rl.Rectangle, backgroundColor rl.Color) Editor {
+func NewEditor(rectangle rl.Rectangle, theme Theme) Editor {
 	pieceTable := pt.NewPieceTable(pt.Sequence{})
 	fontSize := 30
 	defaultFont := rl.GetFontDefault()
 	editor := Editor{
 		WritableRec:         rectangle,
 		EditorRec:           rectangle,
-		BackgroundColor:     backgroundColor,
+		Theme:               theme,
 		PieceTable:          &pieceTable,
 		FontSize:            fontSize,
-		FontColor:           rl.White,
 		Actions:             []Action{},
 		Lines:               make([]*Line, 1),
 		LastCursorPositions: make(map[int]CursorPosition),
 		CharRecCache:        make(map[rune]rl.Vector2),
+		atlasCache:          make(map[rune]*GlyphAtlas),
+		visualLines:         make(map[*Line][]pt.VisualCluster),
+		bidiParagraphs:      make(map[*Line]paragraphLevels),
+		lineEndingChanges:   make(map[int][2]pt.LineEnding),
 		LinesXPadding:       15,
+		TabWidth:            4,
+		ScrollSpeed:         float32(fontSize * 3),
 		InFocus:             false,
 		ShowLines:           true,
 		Font:                &defaultFont,
 		renderTexture:       rl.LoadRenderTexture(rectangle.ToInt32().Width, rectangle.ToInt32().Height),
 	}
 	editor.ChangeFont(&defaultFont)
-	editor.Lines[0] = &Line{
-		Start:       0,
-		Length:      0,
-		Rectangle:   rl.NewRectangle(editor.WritableRec.X, editor.WritableRec.Y, 0, float32(fontSize)),
-		AutoNewLine: false,
-	}
+	editor.Lines[0] = editor.emptyLine(0, editor.WritableRec.Y)
 	// editor.Cursor = NewCursor(rl.NewRectangle(editor.WritableRec.X, editor.WritableRec.Y, 2, float32(fontSize)), 0, 0)
 	editor._updateRenderTexture()
 	return editor
@@ -169,6 +244,7 @@ func (e *Editor) ChangeFont(font *rl.Font) {
 	}
 	// I don't know if it's a good idea to change the cursor position when changing the font, but that will do it for now
 	e.Cursor = NewCursor(rl.NewRectangle(e.WritableRec.X, e.WritableRec.Y, 2, float32(e.FontSize)), 0, 0)
+	e.Cursor.Color = rl.Color(e.Theme.Cursor)
 }
 
 func (e *Editor) Index() int {
@@ -226,35 +302,97 @@ func (e *Editor) CharRectangle(char rune) rl.Vector2 {
 	if ok {
 		return fromCache
 	}
-	charSize := rl.MeasureTextEx(*e.Font, string(char), float32(e.FontSize), 0)
+	charSize := rl.MeasureTextEx(*e.FontFor(char), string(char), float32(e.FontSize), 0)
 	if char == '\n' {
-		charSize.Y = 30 // hardcoded for now, maybe the correct is to assign it the line's height mean
+		charSize.Y = float32(e.FontSize) // maybe the correct is to assign it the line's height mean
 	}
 	e.CharRecCache[char] = charSize
 	return charSize
 }
 
+// the width of the grapheme cluster that starts with char, in monospace mode it's one cell
+// (the width of '0') or two for the wide chars, whatever the font the char comes from
 func (e *Editor) CharWidthWithSpacing(char rune) float32 {
-	if char == '\n' {
+	// the CR of a CRLF is part of the line break, any other CR is kept in the text but never shown
+	if char == '\n' || char == '\r' {
 		return 0
 	}
+	if e.Monospace {
+		return float32(pt.CellWidth(char)) * (e.CharRectangle('0').X + e.CharSpacing)
+	}
 	charSize := e.CharRectangle(char)
 	return charSize.X + e.CharSpacing
 }
 
+// the width of the cluster that starts with char when it's x after its paragraph's start,
+// which only changes the width of a tab, it goes up to the next tab stop
+func (e *Editor) CharWidthAt(char rune, x float32) float32 {
+	if char == '\t' {
+		return e.TabWidthAt(x)
+	}
+	return e.CharWidthWithSpacing(char)
+}
+
+// Tab stops are TabWidth spaces apart, counted from the paragraph's start, a wrapped line doesn't move them.
+// A tab is never thinner than half a space, so a tab right on a stop (float error included) goes to the next one
+func (e *Editor) TabWidthAt(x float32) float32 {
+	space := e.CharWidthWithSpacing(' ')
+	stop := float32(max(e.TabWidth, 1)) * space
+	width := stop - float32(math.Mod(float64(x), float64(stop)))
+	if width < space/2 {
+		width += stop
+	}
+	return width
+}
+
+// The width char adds where it is, x after its paragraph's start. segmenter must have been fed the runes
+// before it since the start of the line. A cluster's first char has the whole cluster's width and
+// the rest of its chars have none, so they never get a column of their own
+func (e *Editor) GraphemeWidth(segmenter *pt.GraphemeSegmenter, char rune, x float32) float32 {
+	if !segmenter.IsBoundary(char) {
+		return 0
+	}
+	return e.CharWidthAt(char, x)
+}
+
 func (e *Editor) SequenceRectangle(sequence pt.Sequence) rl.Vector2 {
 	var vector2 rl.Vector2
+	var segmenter pt.GraphemeSegmenter
 	for _, char := range sequence.RuneForward() {
-		vector2.X += e.CharWidthWithSpacing(char)
+		vector2.X += e.GraphemeWidth(&segmenter, char, vector2.X)
 	}
 	return vector2
 }
 
+// how far index is from the start of its paragraph, a char's width doesn't depend on where the paragraph is wrapped
+func (e *Editor) ParagraphXAt(index int) float32 {
+	paragraph, err := e.PieceTable.LineOfOffset(uint(index))
+	if err != nil {
+		return 0
+	}
+	start, err := e.PieceTable.LineStart(paragraph)
+	if err != nil || uint(index) <= start {
+		return 0
+	}
+	sequence, _, err := e.PieceTable.GetSequence(start, uint(index)-start)
+	if err != nil {
+		return 0
+	}
+	return e.SequenceRectangle(sequence).X
+}
+
 func (e *Editor) SetCursorPositionByIndex(index int) {
 	if index < 0 || index > int(e.PieceTable.RuneLength) {
 		return
 	}
 	lineIndex := e.FindLineByIndex(index, false)
+	if index == int(e.PieceTable.RuneLength) {
+		// the end of a text without a line break at the end is after the last line's last char
+		lineIndex = len(e.Lines) - 1
+	}
+	if lineIndex == -1 {
+		return
+	}
 	line := e.Lines[lineIndex]
 
 	// TODO: Fast path to avoid searching the whole line
@@ -270,78 +408,108 @@ func (e *Editor) SetCursorPositionByIndex(index int) {
 	// 	return
 	// }
 
-	sequence, _, err := e.PieceTable.GetSequence(uint(line.Start), uint(line.Length))
-	if err != nil {
-		return
+	sequence := pt.Sequence{}
+	if line.Length > 0 {
+		var err error
+		sequence, _, err = e.PieceTable.GetSequence(uint(line.Start), uint(line.Length))
+		if err != nil {
+			return
+		}
 	}
 	var column int
 	var previousChar rune
 	var currentIndex int = line.Start
+	var segmenter pt.GraphemeSegmenter
 	positionX := line.Rectangle.X
+	setPosition := func() {
+		e.LastLineVisited = e.Cursor.Line
+		if previousChar != '0' {
+			e.PreviousCharacter = previousChar
+		}
+		e.Cursor.SetPosition(
+			currentIndex,
+			positionX,
+			line.Rectangle.Y,
+			lineIndex,
+			column,
+		)
+		e.ScrollToCursor()
+	}
+	// the cursor only stops between clusters, an index inside one goes to the end of it
 	for _, char := range sequence.RuneForward() {
-		if currentIndex == index {
-			e.LastLineVisited = e.Cursor.Line
-			if previousChar != '0' {
-				e.PreviousCharacter = previousChar
-			}
-			e.Cursor.SetPosition(
-				currentIndex,
-				positionX,
-				line.Rectangle.Y,
-				lineIndex,
-				column,
-			)
+		boundary := segmenter.IsBoundary(char)
+		if currentIndex >= index && boundary {
+			setPosition()
 			return
 		}
 		column++
 		currentIndex++
-		positionX += e.CharWidthWithSpacing(char)
+		if boundary {
+			positionX += e.CharWidthAt(char, line.ParagraphX+positionX-line.Rectangle.X)
+		}
 		previousChar = char
 	}
-}
-
-func (e *Editor) CalculateLines() {
-	addLine := func(line *Line) {
-		e.Lines = append(e.Lines, line)
-		linesCountStr := strconv.Itoa(len(e.Lines))
-		linesCountRec := e.SequenceRectangle(pt.Sequence(linesCountStr))
-		if linesCountRec.Y > e.linesMaxVec.Y {
-			e.linesMaxVec.Y = linesCountRec.Y
-		}
-		if linesCountRec.X > e.linesMaxVec.X {
-			e.linesMaxVec.X = linesCountRec.X
-			e.WritableRec.Width = e.EditorRec.Width - linesCountRec.X - e.LinesXPadding
-			e.WritableRec.X = e.EditorRec.X + linesCountRec.X + e.LinesXPadding
-			e.CalculateLines()
-			return
-		}
+	if currentIndex >= index {
+		setPosition()
 	}
+}
 
+// Wraps the runes into lines. start is the index of the first rune, which must be the
+// beginning of a paragraph, and y is where the first line goes.
+// A paragraph's wrapping doesn't depend on anything before it, that's what lets
+// UpdateLines lay out only the paragraphs touched by an edit
+func (e *Editor) LayoutLines(runes iter.Seq2[int, rune], start int, y float32) []*Line {
+	lines := make([]*Line, 0)
 	currentLine := &Line{
+		start,
 		0,
-		0,
-		rl.NewRectangle(e.WritableRec.X, e.WritableRec.Y, 0, 0),
+		rl.NewRectangle(e.WritableRec.X, y, 0, 0),
 		false,
+		0,
+		0,
 	}
 
-	e.Lines = e.Lines[:0]
+	// a line is as tall as the fonts of its chars need, and never shorter than the main font.
+	// Like the width, the extent is kept at the last space for when the word after it is wrapped
+	baseAscent, baseDescent := e.CharExtent('\n')
+	ascent, descent := baseAscent, baseDescent
+	lastAscent, lastDescent := baseAscent, baseDescent
+	wordAscent, wordDescent := baseAscent, baseDescent
+	fitHeight := func(line *Line, ascent float32, descent float32) {
+		line.Ascent = ascent
+		line.Rectangle.Height = ascent + descent
+	}
 	var lastWidth float32 = -1
 	var lastSpaceIndex int = -1
 	var length int
-	for i, char := range e.PieceTable.Runes() {
-		charSize := e.CharRectangle(char)
-		charWidthSpacing := e.CharWidthWithSpacing(char)
+	var segmenter pt.GraphemeSegmenter
+	// tab stops are counted from the paragraph's start, so a char has the same width wherever the paragraph is wrapped
+	var paragraphX float32
+	for i, char := range runes {
+		i += start
+		boundary := segmenter.IsBoundary(char)
+		var charWidthSpacing float32
+		if boundary {
+			charWidthSpacing = e.CharWidthAt(char, paragraphX)
+		} else if i == lastSpaceIndex+1 {
+			// a mark on a space, wrapping after the space would split them
+			lastSpaceIndex = -1
+		}
 		currentLine.Rectangle.Width += charWidthSpacing
+		paragraphX += charWidthSpacing
 		length++
-		// this serves to adjust the line height to the higher character found
-		if currentLine.Rectangle.Height < charSize.Y {
-			currentLine.Rectangle.Height = charSize.Y
-		}
+		previousAscent, previousDescent := ascent, descent
+		charAscent, charDescent := e.CharExtent(char)
+		ascent, descent = max(ascent, charAscent), max(descent, charDescent)
+		wordAscent, wordDescent = max(wordAscent, charAscent), max(wordDescent, charDescent)
 
-		charOutOfEditorBounds := currentLine.Rectangle.Width > e.WritableRec.Width
+		// lines are only wrapped between clusters, and a line break ends its line even when a word
+		// too long for the editor left it wider
+		charOutOfEditorBounds := boundary && char != '\n' && char != '\r' && currentLine.Rectangle.Width > e.WritableRec.Width
 		if charOutOfEditorBounds {
 			var innerLength int
 			var width float32
+			var lineX float32
 			newLineStart := -1
 			spaceNotFound := lastSpaceIndex == -1 || lastSpaceIndex < currentLine.Start
 			currentLine.AutoNewLine = true
@@ -349,53 +517,152 @@ func (e *Editor) CalculateLines() {
 				// wrap at the character
 				currentLine.Length = i - currentLine.Start
 				currentLine.Rectangle.Width -= charWidthSpacing
-				// e.Lines = append(e.Lines, currentLine)
-				addLine(currentLine)
+				fitHeight(currentLine, previousAscent, previousDescent)
+				lines = append(lines, currentLine)
 				newLineStart = i // might be wrong, perhaps newLineStart = i+1
 				innerLength = 1
 				width = charWidthSpacing
+				lineX = paragraphX - charWidthSpacing
+				ascent, descent = max(baseAscent, charAscent), max(baseDescent, charDescent)
 			} else {
 				// wrap the whole word
 				innerLength = i - lastSpaceIndex
 				width = currentLine.Rectangle.Width - lastWidth
+				lineX = currentLine.ParagraphX + lastWidth
 				currentLine.Length = lastSpaceIndex - currentLine.Start + 1 // plus one because a line's interval is [start, length)
 				currentLine.Rectangle.Width = lastWidth
-				// e.Lines = append(e.Lines, currentLine)
-				addLine(currentLine)
+				fitHeight(currentLine, lastAscent, lastDescent)
+				lines = append(lines, currentLine)
 				charAfterSpace := lastSpaceIndex + 1
 				newLineStart = charAfterSpace
+				ascent, descent = wordAscent, wordDescent
 			}
 			currentLine = &Line{
 				newLineStart,
 				innerLength,
 				rl.NewRectangle(e.WritableRec.X, currentLine.Rectangle.Y+currentLine.Rectangle.Height, width, 0),
 				false,
+				lineX,
+				0,
 			}
 			lastSpaceIndex = -1
 			length = innerLength
 		} else if char == '\n' {
+			paragraphX = 0
 			currentLine.Length = length
 			length = 0
-			// e.Lines = append(e.Lines, currentLine)
-			addLine(currentLine)
+			fitHeight(currentLine, ascent, descent)
+			lines = append(lines, currentLine)
 			currentLine = &Line{
 				i + 1,
 				0,
 				rl.NewRectangle(e.WritableRec.X, currentLine.Rectangle.Y+currentLine.Rectangle.Height, 0, 0),
 				false,
+				0,
+				0,
 			}
+			ascent, descent = baseAscent, baseDescent
+			wordAscent, wordDescent = baseAscent, baseDescent
 		} else if char == ' ' {
 			lastSpaceIndex = i
 			lastWidth = currentLine.Rectangle.Width
+			lastAscent, lastDescent = ascent, descent
+			wordAscent, wordDescent = baseAscent, baseDescent
 		}
 	}
 
 	if length > 0 {
 		currentLine.Length = length
-		// e.Lines = append(e.Lines, currentLine)
-		addLine(currentLine)
+		fitHeight(currentLine, ascent, descent)
+		lines = append(lines, currentLine)
+	}
+	return lines
+}
+
+// A text ending with a line break gets an empty last line, so the cursor can go after it.
+// It's the only line with Length 0, besides the one of an empty text
+func (e *Editor) FitTrailingLine() {
+	lastLine := e.LastLine()
+	if lastLine.Length == 0 && len(e.Lines) > 1 {
+		e.Lines = e.Lines[:len(e.Lines)-1]
+		lastLine = e.LastLine()
+	}
+	if e.PieceTable.RuneLength == 0 {
+		return
+	}
+	lastChar, err := e.PieceTable.GetAt(e.PieceTable.RuneLength - 1)
+	if err != nil || lastChar != '\n' {
+		return
+	}
+	e.Lines = append(e.Lines, e.emptyLine(int(e.PieceTable.RuneLength), lastLine.Rectangle.Y+lastLine.Rectangle.Height))
+}
+
+// a line without chars at start, it's as tall as the main font
+func (e *Editor) emptyLine(start int, y float32) *Line {
+	ascent, descent := e.CharExtent('\n')
+	return &Line{
+		start,
+		0,
+		rl.NewRectangle(e.WritableRec.X, y, 0, ascent+descent),
+		false,
+		0,
+		ascent,
+	}
+}
+
+// whether the line ends with a line break, every line but the last does when it wasn't wrapped
+func (e *Editor) EndsWithLineBreak(lineIndex int) bool {
+	return !e.Lines[lineIndex].AutoNewLine && lineIndex < len(e.Lines)-1
+}
+
+// how many runes the line break at the end of the line has, 2 for a CRLF and 0 when there is none.
+// The last column a cursor can be in is the line's Length minus this
+func (e *Editor) LineBreakLength(lineIndex int) int {
+	if !e.EndsWithLineBreak(lineIndex) {
+		return 0
 	}
+	line := e.Lines[lineIndex]
+	if line.Length >= 2 {
+		char, err := e.PieceTable.GetAt(uint(line.Start + line.Length - 2))
+		if err == nil && char == '\r' {
+			return 2
+		}
+	}
+	return 1
+}
+
+// the line numbers column grows with the amount of digits,
+// returns true if it grew, which means every line needs to be wrapped again
+func (e *Editor) FitLineNumbers() bool {
+	linesCountStr := strconv.Itoa(len(e.Lines))
+	linesCountRec := e.SequenceRectangle(pt.Sequence(linesCountStr))
+	if linesCountRec.Y > e.linesMaxVec.Y {
+		e.linesMaxVec.Y = linesCountRec.Y
+	}
+	if linesCountRec.X > e.linesMaxVec.X {
+		e.linesMaxVec.X = linesCountRec.X
+		e.WritableRec.Width = e.EditorRec.Width - linesCountRec.X - e.LinesXPadding
+		e.WritableRec.X = e.EditorRec.X + linesCountRec.X + e.LinesXPadding
+		return true
+	}
+	return false
+}
 
+func (e *Editor) CalculateLines() {
+	clear(e.visualLines)
+	clear(e.bidiParagraphs)
+	e.Lines = e.LayoutLines(e.PieceTable.Runes(), 0, e.WritableRec.Y)
+	if len(e.Lines) == 0 {
+		// an empty text still needs a line for the cursor to be in
+		e.Lines = append(e.Lines, e.emptyLine(0, e.WritableRec.Y))
+	}
+	e.FitTrailingLine()
+	if e.FitLineNumbers() {
+		e.CalculateLines()
+		return
+	}
+
+	e.ScrollY = e.ClampScroll(e.ScrollY)
 	e._updateRenderTexture()
 
 	// ------------ Debugging ------------
@@ -410,48 +677,250 @@ func (e *Editor) CalculateLines() {
 
 }
 
+// Lays out again only the paragraphs touched by an edit at position, which
+// inserted and/or deleted that many runes, and shifts the lines after them.
+// It must be called right after the edit, while e.Lines still describes the text before it
+func (e *Editor) UpdateLines(position int, inserted int, deleted int) {
+	table := e.PieceTable
+	wasEmpty := int(table.RuneLength)-inserted+deleted == 0
+	if wasEmpty || table.Empty() {
+		e.CalculateLines()
+		return
+	}
+	firstParagraph, err := table.LineOfOffset(uint(position))
+	if err != nil {
+		e.CalculateLines()
+		return
+	}
+	lastParagraph, err := table.LineOfOffset(uint(position + inserted))
+	if err != nil {
+		e.CalculateLines()
+		return
+	}
+	start, _ := table.LineStart(firstParagraph)
+	end := table.RuneLength
+	if lastParagraph+1 < table.LineCount() {
+		end, _ = table.LineStart(lastParagraph + 1)
+	}
+	oldEnd := int(end) - inserted + deleted
+
+	// lines are sorted by Start, and a paragraph always begins a new line
+	first := sort.Search(len(e.Lines), func(i int) bool { return e.Lines[i].Start >= int(start) })
+	last := sort.Search(len(e.Lines), func(i int) bool { return e.Lines[i].Start >= oldEnd })
+
+	y := e.WritableRec.Y
+	if first > 0 {
+		previous := e.Lines[first-1]
+		y = previous.Rectangle.Y + previous.Rectangle.Height
+	}
+	oldBottom := y
+	if last > first {
+		oldBottom = e.Lines[last-1].Rectangle.Y + e.Lines[last-1].Rectangle.Height
+	}
+
+	newLines := []*Line{}
+	if end > start {
+		sequence, _, err := table.GetSequence(start, end-start)
+		if err != nil {
+			e.CalculateLines()
+			return
+		}
+		newLines = e.LayoutLines(sequence.RuneForward(), int(start), y)
+	}
+	newBottom := y
+	if len(newLines) > 0 {
+		lastNewLine := newLines[len(newLines)-1]
+		newBottom = lastNewLine.Rectangle.Y + lastNewLine.Rectangle.Height
+	}
+
+	// the lines after keep their visual clusters, which don't depend on where the line is
+	for _, line := range e.Lines[first:last] {
+		delete(e.visualLines, line)
+		delete(e.bidiParagraphs, line)
+	}
+	shift := inserted - deleted
+	shiftY := newBottom - oldBottom
+	for _, line := range e.Lines[last:] {
+		line.Start += shift
+		line.Rectangle.Y += shiftY
+	}
+	e.Lines = slices.Concat(e.Lines[:first], newLines, e.Lines[last:])
+	e.FitTrailingLine()
+
+	if e.FitLineNumbers() {
+		e.CalculateLines()
+		return
+	}
+	e.ScrollY = e.ClampScroll(e.ScrollY)
+	e._updateRenderTexture()
+}
+
+// indexes of the first visible line and the one after the last visible line
+func (e *Editor) VisibleLines() (int, int) {
+	top := e.EditorRec.Y + e.ScrollY
+	bottom := top + e.EditorRec.Height
+	first := sort.Search(len(e.Lines), func(i int) bool {
+		return e.Lines[i].Rectangle.Y+e.Lines[i].Rectangle.Height > top
+	})
+	last := sort.Search(len(e.Lines), func(i int) bool {
+		return e.Lines[i].Rectangle.Y >= bottom
+	})
+	return first, max(first, last)
+}
+
+// the number sits on the line's baseline like the text
+func (e *Editor) DrawLineNumber(lineIndex int, y float32) {
+	line := e.Lines[lineIndex]
+	rl.DrawRectangle(e.EditorRec.ToInt32().X, int32(y), int32(e.linesMaxVec.X)+int32(e.LinesXPadding), int32(line.Rectangle.Height), rl.Color(e.Theme.Gutter))
+	color := rl.Color(e.Theme.LineNumber)
+	if lineIndex == e.Cursor.Line {
+		color = rl.Color(e.Theme.CurrentLineNumber)
+	}
+	ascent, _ := e.CharExtent('0')
+	rl.DrawTextEx(*e.Font, utils.IntToString(lineIndex+1), rl.NewVector2(e.EditorRec.X, y+line.Ascent-ascent), float32(e.FontSize), 0, color)
+}
+
+// Draws only the lines inside the editor, each one with DrawRunes, or DrawVisualLine when it has right to left text.
+// Its glyphs are placed by the same widths CharWidthWithSpacing gives,
+// so the text ends up where the lines and the cursor expect it to be
 func (e *Editor) DrawText() {
-	currentLineIndex := 0
-	currentLine := e.Lines[currentLineIndex]
-	charXPosition := currentLine.Rectangle.X
-	length := 0
-	DrawLineNumber := func() {
-		rl.DrawRectangle(e.EditorRec.ToInt32().X, currentLine.Rectangle.ToInt32().Y, int32(e.linesMaxVec.X)+int32(e.LinesXPadding), int32(e.linesMaxVec.Y), e.BackgroundColor)
-		color := rl.NewColor(90, 90, 90, 255)
-		if currentLineIndex == e.Cursor.Line {
-			color = rl.White
-		}
-		rl.DrawTextEx(*e.Font, utils.IntToString(currentLineIndex+1), rl.NewVector2(e.EditorRec.X, currentLine.Rectangle.Y), float32(e.FontSize), 0, color)
-	}
-	if e.PieceTable.Empty() {
-		DrawLineNumber()
-		return
-	}
-	for _, char := range e.PieceTable.ToString() {
-		if length >= currentLine.Length {
-			currentLineIndex++
-			if currentLineIndex < len(e.Lines) {
-				currentLine = e.Lines[currentLineIndex]
+	first, last := e.VisibleLines()
+	for i := first; i < last; i++ {
+		line := e.Lines[i]
+		y := line.Rectangle.Y - e.ScrollY
+		e.DrawLineNumber(i, y)
+		if line.Length == 0 {
+			continue
+		}
+		sequence, _, err := e.PieceTable.GetSequence(uint(line.Start), uint(line.Length))
+		if err != nil {
+			continue
+		}
+		clusters := e.VisualClusters(i)
+		for _, selection := range e.Selections() {
+			e.DrawSelection(selection, line, sequence, clusters, y)
+		}
+		baseline := y + line.Ascent
+		if clusters != nil {
+			e.DrawVisualLine(clusters, sequence, baseline, rl.Color(e.Theme.Text))
+			continue
+		}
+		text := strings.TrimSuffix(strings.TrimSuffix(string(sequence), "\n"), "\r")
+		e.DrawRunes(text, rl.NewVector2(line.Rectangle.X, baseline), line.ParagraphX, rl.Color(e.Theme.Text))
+	}
+}
+
+// Draws text with one DrawTextEx for each run of chars that use the same font,
+// every run starts where the widths of the chars before it end.
+// DrawTextEx advances by the glyphs' widths, so the chars that take a different width (the wide ones
+// in monospace mode) are drawn on their own, centered in their cells, and so are the chars after
+// a cluster's first one, which go over it like the font expects combining marks to.
+// position.Y is the baseline, every font's glyphs are drawn from its own ascent above it.
+// paragraphX is where the text starts after its paragraph's start, for its tabs to end at the tab stops
+func (e *Editor) DrawRunes(text string, position rl.Vector2, paragraphX float32, color rl.Color) {
+	runStart := 0
+	runX := position.X
+	var runY float32
+	x := position.X
+	penX := position.X // where the next char of the current cluster is drawn
+	var runFont *rl.Font
+	var segmenter pt.GraphemeSegmenter
+	drawRun := func(end int) {
+		if runFont != nil && end > runStart {
+			rl.DrawTextEx(*runFont, text[runStart:end], rl.NewVector2(runX, runY), float32(e.FontSize), e.CharSpacing, color)
+		}
+		runFont = nil
+	}
+	for i, char := range text {
+		font := e.FontFor(char)
+		boundary := segmenter.IsBoundary(char)
+		width := e.CharWidthAt(char, paragraphX+x-position.X)
+		glyphWidth := e.CharRectangle(char).X
+		inRun := boundary && isGlyph(char) && width == glyphWidth+e.CharSpacing
+		ascent, _ := e.CharExtent(char)
+		if !inRun || font != runFont {
+			drawRun(i)
+			if inRun {
+				runStart, runX, runY, runFont = i, x, position.Y-ascent, font
 			}
-			length = 0
-			charXPosition = currentLine.Rectangle.X
 		}
-		length++
-		stringChar := string(char)
-		rl.DrawTextEx(*e.Font, stringChar, rl.NewVector2(charXPosition, currentLine.Rectangle.Y), float32(e.FontSize), 0, e.FontColor)
-		DrawLineNumber()
-		charXPosition += e.CharWidthWithSpacing(char)
+		if boundary {
+			penX = x + (width-glyphWidth-e.CharSpacing)/2
+			x += width
+		}
+		if !inRun && e.IsDrawable(char, boundary) {
+			rl.DrawTextCodepoint(*font, char, rl.NewVector2(penX, position.Y-ascent), float32(e.FontSize), color)
+		}
+		if boundary {
+			penX += glyphWidth
+		}
+	}
+	drawRun(len(text))
+}
+
+// Format chars like the ZWJ are never drawn, and the marks of a cluster only when a font has them,
+// raylib would draw the missing glyph over the cluster otherwise
+func (e *Editor) IsDrawable(char rune, clusterStart bool) bool {
+	if !isGlyph(char) || unicode.Is(unicode.Cf, char) {
+		return false
 	}
+	return clusterStart || e.Glyphs == nil || e.atlasFor(char).Covers(char)
+}
+
+// Highlights the selected part of line, a selected line break is drawn as a space.
+// On a line with right to left text, clusters are its VisualClusters and the selected part can be in many pieces
+func (e *Editor) DrawSelection(selection Selection, line *Line, sequence pt.Sequence, clusters []pt.VisualCluster, y float32) {
+	start := max(selection.Start(), line.Start)
+	end := min(selection.End(), line.Start+line.Length)
+	if selection.IsEmpty() || start >= end {
+		return
+	}
+	if clusters != nil {
+		color := rl.Color(e.Theme.Selection)
+		for _, cluster := range clusters {
+			index := line.Start + cluster.Start
+			if index < end && index+cluster.Length > start {
+				rl.DrawRectangleRec(rl.NewRectangle(cluster.X, y, cluster.Width, line.Rectangle.Height), color)
+			}
+		}
+		if bytes.HasSuffix(sequence, []byte("\n")) && end == line.Start+line.Length {
+			rl.DrawRectangleRec(rl.NewRectangle(line.Rectangle.X+line.Rectangle.Width, y, e.CharWidthWithSpacing(' '), line.Rectangle.Height), color)
+		}
+		return
+	}
+	x := line.Rectangle.X
+	var startX, endX float32
+	var segmenter pt.GraphemeSegmenter
+	for i, char := range sequence.RuneForward() {
+		index := line.Start + i
+		if index == start {
+			startX = x
+		}
+		width := e.GraphemeWidth(&segmenter, char, line.ParagraphX+x-line.Rectangle.X)
+		if char == '\n' {
+			width = e.CharWidthWithSpacing(' ')
+		}
+		x += width
+		if index == end-1 {
+			endX = x
+			break
+		}
+	}
+	rl.DrawRectangleRec(rl.NewRectangle(startX, y, endX-startX, line.Rectangle.Height), rl.Color(e.Theme.Selection))
 }
 
 func (e *Editor) _updateRenderTexture() {
+	if e.renderPaused {
+		e.renderPending = true
+		return
+	}
 	rl.BeginTextureMode(e.renderTexture)
 	rl.ClearBackground(rl.Blank)
 	rl.DrawRectanglePro(
 		e.EditorRec,
 		rl.NewVector2(0, 0),
 		0,
-		e.BackgroundColor,
+		rl.Color(e.Theme.Background),
 	)
 	e.DrawText()
 	rl.EndTextureMode()
@@ -466,122 +935,404 @@ func (e *Editor) Draw() {
 		rl.NewVector2(e.EditorRec.X, e.EditorRec.Y),
 		rl.White,
 	)
+	rl.BeginScissorMode(e.EditorRec.ToInt32().X, e.EditorRec.ToInt32().Y, e.EditorRec.ToInt32().Width, e.EditorRec.ToInt32().Height)
+	// the cursor moves without drawing the text again, so the current line is drawn over the text
+	currentLine := e.CurrentLine()
+	rl.DrawRectangleRec(
+		rl.NewRectangle(e.WritableRec.X, currentLine.Rectangle.Y-e.ScrollY, e.EditorRec.X+e.EditorRec.Width-e.WritableRec.X, currentLine.Rectangle.Height),
+		rl.Color(e.Theme.CurrentLine),
+	)
 	// if e.InFocus {
-	e.Cursor.Draw()
+	for i := range e.ExtraCursors {
+		e.drawCursor(&e.ExtraCursors[i].Cursor)
+	}
+	e.drawCursor(&e.Cursor)
 	// }
+	e.DrawScrollbar()
+	rl.EndScissorMode()
+}
+
+// the cursor is drawn where its column is on the screen, which isn't its X on right to left text,
+// and it's as tall as its line
+func (e *Editor) drawCursor(cursor *Cursor) {
+	if cursor.Line < len(e.Lines) {
+		cursor.Rectangle.Height = e.Lines[cursor.Line].Rectangle.Height
+	}
+	x := cursor.Rectangle.X
+	cursor.Rectangle.X = e.VisualX(cursor.Line, cursor.Column, x)
+	cursor.Draw(e.ScrollY)
+	cursor.Rectangle.X = x
 }
 
 func (e *Editor) SetFontSize(fontSize int) {
 	e.FontSize = fontSize
-	e.Cursor.Rectangle.Height = float32(fontSize)
 }
 
-func (e *Editor) FindPositionByLineColumn(line int, column int) float32 {
-	lineToSearch := e.Lines[line]
-	sequence, _, err := e.PieceTable.GetSequence(uint(lineToSearch.Start), uint(lineToSearch.Length))
+// @bidi
+// The text, the cursors and the lines are all in logical order, the order the text is typed in.
+// Only the lines with right to left text are drawn in another order, the visual one, which the
+// bidi algorithm gives for every cluster. A paragraph whose first strong char is right to left
+// has a right to left base level (P2, P3), but its lines still start at the left of the editor
 
-	if err != nil {
-		return -1
+// The clusters of the line from left to right, nil when the line is drawn in logical order.
+// They're cached until the line is laid out again
+func (e *Editor) VisualClusters(lineIndex int) []pt.VisualCluster {
+	line := e.Lines[lineIndex]
+	if line.Length == 0 {
+		return nil
 	}
-	var width float32 = 0
-	for i, char := range sequence.RuneForward() {
-		if i == column {
-			break
-		}
-		width += e.CharWidthWithSpacing(char)
+	clusters, ok := e.visualLines[line]
+	if ok {
+		return clusters
 	}
-	return e.WritableRec.X + width
+	clusters = e.layoutVisualClusters(lineIndex)
+	e.visualLines[line] = clusters
+	return clusters
 }
 
-func (e *Editor) FindLineByIndex(index int, inclusive bool) int {
-	for i, line := range e.Lines {
-		end := line.Start + line.Length
-		if !inclusive {
-			end--
-		}
-		autoNewLine := line.Start <= index && index <= end && line.AutoNewLine && (e.Cursor.Column > 0 || e.Cursor.Column == 0 && e.Cursor.Line == i)
-		notAutoNewLine := line.Start <= index && index < line.Start+line.Length && !line.AutoNewLine
-		if autoNewLine || notAutoNewLine {
-			return i
+// the levels of a paragraph's runes without its line break and the paragraph's own level,
+// Levels is nil when the paragraph has no right to left text
+type paragraphLevels struct {
+	Levels []int
+	Base   int
+}
+
+// The levels of the paragraph the line is in and where the line starts in it. They're resolved
+// once for all the lines of the paragraph and cached until the paragraph is laid out again
+func (e *Editor) paragraphLevelsOf(lineIndex int) (paragraphLevels, int) {
+	first := lineIndex
+	for first > 0 && e.Lines[first-1].AutoNewLine {
+		first--
+	}
+	start := e.Lines[first].Start
+	lineStart := e.Lines[lineIndex].Start - start
+	paragraph, ok := e.bidiParagraphs[e.Lines[first]]
+	if ok {
+		return paragraph, lineStart
+	}
+	last := lineIndex
+	for last < len(e.Lines)-1 && e.Lines[last].AutoNewLine {
+		last++
+	}
+	end := e.Lines[last].Start + e.Lines[last].Length
+	sequence, _, err := e.PieceTable.GetSequence(uint(start), uint(end-start))
+	if err == nil {
+		runes := []rune(strings.TrimSuffix(strings.TrimSuffix(string(sequence), "\n"), "\r"))
+		if pt.HasRightToLeft(runes) {
+			paragraph.Base = pt.BidiParagraphLevel(runes)
+			paragraph.Levels = pt.BidiLevels(runes, paragraph.Base)
 		}
 	}
-	return -1
+	e.bidiParagraphs[e.Lines[first]] = paragraph
+	return paragraph, lineStart
 }
 
-// returns: lineIndex, line, inXBounds, column, index, columnXPosition, previousChar, error
-func (e *Editor) FindLineClickMetadata(mouseClick rl.Vector2) (int, *Line, bool, int, int, float32, rune, error) {
-	for i, line := range e.Lines {
-		inLineXBoundaries := mouseClick.X >= line.Rectangle.X && mouseClick.X <= line.Rectangle.X+line.Rectangle.Width
-		inLineYBoundaries := mouseClick.Y >= line.Rectangle.Y && mouseClick.Y <= line.Rectangle.Y+line.Rectangle.Height
-		if inLineXBoundaries && inLineYBoundaries {
-			sequence, _, err := e.PieceTable.GetSequence(uint(line.Start), uint(line.Length))
-			if err != nil {
-				return -1, nil, false, -1, -1, -1, -1, err
-			}
-			var previousCharacter rune
-			var previousCharacterX float32
-			var column int
-			currentIndex := line.Start
-			charXPosition := line.Rectangle.X
-			for _, char := range sequence.RuneForward() {
-				if char == '\n' {
-					break
-				}
-				charWidth := e.CharWidthWithSpacing(char)
-				betweenPostPreviousCharHalfAndPreCharHalf := mouseClick.X > previousCharacterX && mouseClick.X < charXPosition+(charWidth/2)
-				if betweenPostPreviousCharHalfAndPreCharHalf || char == '\n' && i == len(sequence) {
-					break
-				}
-				previousCharacter = char
-				previousCharacterX = charXPosition
-				charXPosition += charWidth
-				currentIndex++
-				column++
-			}
-			return i, line, true, column, currentIndex, charXPosition, previousCharacter, nil
+func (e *Editor) layoutVisualClusters(lineIndex int) []pt.VisualCluster {
+	line := e.Lines[lineIndex]
+	paragraph, lineStart := e.paragraphLevelsOf(lineIndex)
+	lineEnd := min(lineStart+line.Length, len(paragraph.Levels))
+	if paragraph.Levels == nil || lineEnd <= lineStart {
+		return nil
+	}
+	sequence, _, err := e.PieceTable.GetSequence(uint(line.Start), uint(lineEnd-lineStart))
+	if err != nil {
+		return nil
+	}
+	lineRunes := []rune(string(sequence))
+	levels := pt.BidiLineLevels(lineRunes, paragraph.Levels[lineStart:lineEnd], paragraph.Base)
+	width := func(char rune, x float32) float32 { return e.CharWidthAt(char, line.ParagraphX+x) }
+	return pt.VisualClusters(lineRunes, levels, line.Rectangle.X, width)
+}
+
+// where the cursor at column is drawn, x being where it is in logical order
+func (e *Editor) VisualX(lineIndex int, column int, x float32) float32 {
+	if lineIndex < 0 || lineIndex >= len(e.Lines) {
+		return x
+	}
+	return pt.VisualCursorX(e.VisualClusters(lineIndex), column, x)
+}
+
+// Draws a line that has right to left text. The left to right clusters that follow each other
+// in the text are drawn together, the right to left ones one by one, with their mirrored
+// bracket if they have one. Tabs aren't drawn, so a run never has one to put at the wrong tab stop
+func (e *Editor) DrawVisualLine(clusters []pt.VisualCluster, sequence pt.Sequence, baseline float32, color rl.Color) {
+	runes := []rune(string(sequence))
+	isTab := func(cluster pt.VisualCluster) bool { return runes[cluster.Start] == '\t' }
+	for i := 0; i < len(clusters); i++ {
+		cluster := clusters[i]
+		text := runes[cluster.Start : cluster.Start+cluster.Length]
+		if isTab(cluster) {
+			continue
 		}
-		// if it isn't on line X boundaries, it makes no sense to search the metadata
-		if inLineYBoundaries {
-			index := line.Start + line.Length
-			column := line.Length
-			if !line.AutoNewLine {
-				index--
-				column--
+		if cluster.RightToLeft {
+			mirror, ok := pt.BIDI_MIRRORS[text[0]]
+			if ok {
+				text = slices.Concat([]rune{mirror}, text[1:])
 			}
-			previousChar, _ := e.PieceTable.GetAt(uint(index - 1))
-			return i, line, false, column, index, line.Rectangle.X + line.Rectangle.Width, previousChar, nil
+		} else {
+			end := cluster.Start + cluster.Length
+			for i+1 < len(clusters) && !clusters[i+1].RightToLeft && clusters[i+1].Start == end && !isTab(clusters[i+1]) {
+				i++
+				end += clusters[i].Length
+			}
+			text = runes[cluster.Start:end]
 		}
+		e.DrawRunes(string(text), rl.NewVector2(cluster.X, baseline), 0, color)
 	}
-	return -1, nil, false, -1, -1, -1, -1, nil
 }
 
-func (e *Editor) MoveCursorForward() {
-	currentLine := e.CurrentLine()
-	if e.Cursor.CurrentIndex == int(e.PieceTable.RuneLength)-1 {
-		// if e.Cursor.Line == len(e.Lines)-1 && e.Cursor.Column == currentLine.Length-1 {
+// @glyphs
+// Adds the chars of sequence missing from the font's atlas, it must happen before they're measured.
+// The font is rebuilt but it stays at the same address, so only the new chars' sizes are stale
+func (e *Editor) AddGlyphs(sequence pt.Sequence) {
+	if e.Glyphs == nil {
 		return
 	}
-	clear(e.LastCursorPositions)
+	missing := map[*GlyphAtlas][]rune{}
+	seen := map[rune]bool{}
+	for _, char := range sequence.RuneForward() {
+		if seen[char] || !isGlyph(char) {
+			continue
+		}
+		seen[char] = true
+		atlas := e.atlasFor(char)
+		if !atlas.Has(char) {
+			missing[atlas] = append(missing[atlas], char)
+		}
+	}
+	for atlas, chars := range missing {
+		added, err := atlas.Add(chars)
+		if err != nil {
+			utils.Logger.Println(err)
+		}
+		for _, char := range added {
+			delete(e.CharRecCache, char)
+		}
+	}
+}
+
+// the first font of Glyphs and Fallbacks that has char, Glyphs when none of them has it
+func (e *Editor) atlasFor(char rune) *GlyphAtlas {
+	atlas, ok := e.atlasCache[char]
+	if ok {
+		return atlas
+	}
+	atlas = e.Glyphs
+	if !e.Glyphs.Covers(char) {
+		for _, fallback := range e.Fallbacks {
+			if fallback.Covers(char) {
+				atlas = fallback
+				break
+			}
+		}
+	}
+	e.atlasCache[char] = atlas
+	return atlas
+}
+
+// How far the font char is drawn with goes above and below the baseline at FontSize,
+// the chars that aren't glyphs take the main font's. The default font's glyphs hang from the top
+func (e *Editor) CharExtent(char rune) (float32, float32) {
+	if e.Glyphs == nil {
+		return float32(e.FontSize), 0
+	}
+	atlas := e.Glyphs
+	if isGlyph(char) {
+		atlas = e.atlasFor(char)
+	}
+	return atlas.Extent(float32(e.FontSize))
+}
+
+// the font char is measured and drawn with
+func (e *Editor) FontFor(char rune) *rl.Font {
+	if e.Glyphs == nil {
+		return e.Font
+	}
+	return &e.atlasFor(char).Font
+}
+
+// Changes the fonts, fallbacks can be empty. The atlases get the chars of the text and the
+// sizes are measured again with Relayout
+func (e *Editor) SetFonts(glyphs *GlyphAtlas, fallbacks []*GlyphAtlas) {
+	e.Glyphs = glyphs
+	e.Fallbacks = fallbacks
+	e.Font = &glyphs.Font
+	clear(e.atlasCache)
+	clear(e.CharRecCache)
+	e.AddGlyphs(e.PieceTable.Bytes())
+}
+
+// @settings
+func (e *Editor) SetTheme(theme Theme) {
+	e.Theme = theme
+	e.Cursor.Color = rl.Color(theme.Cursor)
+	for i := range e.ExtraCursors {
+		e.ExtraCursors[i].Cursor.Color = rl.Color(theme.Cursor)
+	}
+	e._updateRenderTexture()
+}
+
+// moves the editor to rectangle, the render texture is recreated with the new size
+func (e *Editor) Resize(rectangle rl.Rectangle) {
+	if rectangle == e.EditorRec {
+		return
+	}
+	e.EditorRec = rectangle
+	rl.UnloadRenderTexture(e.renderTexture)
+	e.renderTexture = rl.LoadRenderTexture(rectangle.ToInt32().Width, rectangle.ToInt32().Height)
+	e.Relayout()
+}
+
+// Wraps every line again after the font, its size, the spacing or the rectangle changed.
+// Unlike ChangeFont every cursor keeps its index, only their rectangles are recomputed
+func (e *Editor) Relayout() {
+	clear(e.CharRecCache)
+	e.linesMaxVec = rl.Vector2{}
+	e.WritableRec = e.EditorRec
+	e.CalculateLines()
+	e.ScrollY = e.ClampScroll(e.ScrollY)
+	scrollY := e.ScrollY
+	for i := range e.ExtraCursors {
+		e.swapCursor(&e.ExtraCursors[i])
+		e.SetCursorPositionByIndex(min(e.Cursor.CurrentIndex, int(e.PieceTable.RuneLength)))
+		e.swapCursor(&e.ExtraCursors[i])
+	}
+	e.SetScroll(scrollY)
+	e.SetCursorPositionByIndex(min(e.Cursor.CurrentIndex, int(e.PieceTable.RuneLength)))
+	e._updateRenderTexture()
+}
+
+func (e *Editor) FindPositionByLineColumn(line int, column int) float32 {
+	lineToSearch := e.Lines[line]
+	sequence, _, err := e.PieceTable.GetSequence(uint(lineToSearch.Start), uint(lineToSearch.Length))
+
+	if err != nil {
+		return -1
+	}
+	var width float32 = 0
+	var segmenter pt.GraphemeSegmenter
+	for i, char := range sequence.RuneForward() {
+		if i == column {
+			break
+		}
+		width += e.GraphemeWidth(&segmenter, char, lineToSearch.ParagraphX+width)
+	}
+	return e.WritableRec.X + width
+}
+
+func (e *Editor) FindLineByIndex(index int, inclusive bool) int {
+	for i, line := range e.Lines {
+		end := line.Start + line.Length
+		if !inclusive {
+			end--
+		}
+		// only the index right after a wrapped line is ambiguous, it's also the next line's start
+		inside := index < line.Start+line.Length || e.Cursor.Column > 0 || e.Cursor.Column == 0 && e.Cursor.Line == i
+		autoNewLine := line.Start <= index && index <= end && line.AutoNewLine && inside
+		notAutoNewLine := line.Start <= index && index < line.Start+line.Length && !line.AutoNewLine
+		if autoNewLine || notAutoNewLine {
+			return i
+		}
+	}
+	return -1
+}
+
+// returns: lineIndex, line, inXBounds, column, index, columnXPosition, previousChar, error
+func (e *Editor) FindLineClickMetadata(mouseClick rl.Vector2) (int, *Line, bool, int, int, float32, rune, error) {
+	for i, line := range e.Lines {
+		inLineXBoundaries := line.Length > 0 && mouseClick.X >= line.Rectangle.X && mouseClick.X <= line.Rectangle.X+line.Rectangle.Width
+		inLineYBoundaries := mouseClick.Y >= line.Rectangle.Y && mouseClick.Y <= line.Rectangle.Y+line.Rectangle.Height
+		if inLineXBoundaries && inLineYBoundaries {
+			sequence, _, err := e.PieceTable.GetSequence(uint(line.Start), uint(line.Length))
+			if err != nil {
+				return -1, nil, false, -1, -1, -1, -1, err
+			}
+			clusters := e.VisualClusters(i)
+			if clusters != nil {
+				column := pt.VisualClickColumn(clusters, mouseClick.X)
+				var previousChar rune
+				if column > 0 {
+					previousChar, _ = e.PieceTable.GetAt(uint(line.Start + column - 1))
+				}
+				return i, line, true, column, line.Start + column, e.FindPositionByLineColumn(i, column), previousChar, nil
+			}
+			var previousCharacter rune
+			var previousCharacterX float32
+			var column int
+			currentIndex := line.Start
+			charXPosition := line.Rectangle.X
+			contentLength := line.Length - e.LineBreakLength(i)
+			var segmenter pt.GraphemeSegmenter
+			for _, char := range sequence.RuneForward() {
+				if column == contentLength {
+					break
+				}
+				// the chars after a cluster's first one are skipped, so the click lands between clusters
+				if segmenter.IsBoundary(char) {
+					charWidth := e.CharWidthAt(char, line.ParagraphX+charXPosition-line.Rectangle.X)
+					betweenPostPreviousCharHalfAndPreCharHalf := mouseClick.X > previousCharacterX && mouseClick.X < charXPosition+(charWidth/2)
+					if betweenPostPreviousCharHalfAndPreCharHalf {
+						break
+					}
+					previousCharacterX = charXPosition
+					charXPosition += charWidth
+				}
+				previousCharacter = char
+				currentIndex++
+				column++
+			}
+			return i, line, true, column, currentIndex, charXPosition, previousCharacter, nil
+		}
+		// if it isn't on line X boundaries, it makes no sense to search the metadata
+		if inLineYBoundaries {
+			index := line.Start + line.Length
+			column := line.Length
+			x := line.Rectangle.X + line.Rectangle.Width
+			lineBreakLength := e.LineBreakLength(i)
+			index -= lineBreakLength
+			column -= lineBreakLength
+			previousChar, _ := e.PieceTable.GetAt(uint(index - 1))
+			return i, line, false, column, index, x, previousChar, nil
+		}
+	}
+	return -1, nil, false, -1, -1, -1, -1, nil
+}
+
+func (e *Editor) MoveCursorForward() {
+	currentLine := e.CurrentLine()
 	currentChar, _ := e.CurrentChar()
+	isLastIndex := e.Cursor.CurrentIndex >= int(e.PieceTable.RuneLength)
+	if isLastIndex {
+		// if e.Cursor.Line == len(e.Lines)-1 && e.Cursor.Column == currentLine.Length-1 {
+		return
+	}
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
+	clear(e.LastCursorPositions)
 	nextCharIsSpace := currentChar == ' '
 	isEndOfLineSpace := e.Cursor.Column >= currentLine.Length-1 && nextCharIsSpace
 	isEndOfLine := isEndOfLineSpace || e.Cursor.Column >= currentLine.Length
-	isNewLine := currentChar == '\n'
-	isCharacter := !isEndOfLine && !isNewLine
+	lineBreakLength := e.LineBreakLength(e.Cursor.Line)
+	isNewLine := lineBreakLength > 0 && e.Cursor.Column >= currentLine.Length-lineBreakLength
+	isLastLine := e.Cursor.Line == len(e.Lines)-1
+	isCharacter := (!isEndOfLine && !isNewLine) || isLastLine
 	if isCharacter {
-		e.PreviousCharacter = currentChar
+		// the whole cluster is moved over
+		next := int(e.PieceTable.NextGraphemeBoundary(uint(e.Cursor.CurrentIndex)))
+		e.PreviousCharacter, _ = e.PieceTable.GetAt(uint(next - 1))
 		e.Cursor.SetPosition(
-			e.Cursor.CurrentIndex+1,
-			e.Cursor.Rectangle.X+e.CharWidthWithSpacing(currentChar),
+			next,
+			e.Cursor.Rectangle.X+e.CharWidthAt(currentChar, currentLine.ParagraphX+e.Cursor.Rectangle.X-currentLine.Rectangle.X),
 			currentLine.Rectangle.Y,
 			e.Cursor.Line,
-			e.Cursor.Column+1,
+			e.Cursor.Column+next-e.Cursor.CurrentIndex,
 		)
 	} else {
 		e.LastLineVisited = e.Cursor.Line
 		e.Cursor.Column = 0
 		e.Cursor.Rectangle.X = e.WritableRec.X
-		if isNewLine || isEndOfLineSpace {
+		if isNewLine {
+			e.Cursor.CurrentIndex += lineBreakLength
+		} else if isEndOfLineSpace {
 			e.Cursor.CurrentIndex++
 		}
 		nextLine, _ := e.NextLine()
@@ -594,18 +1345,16 @@ func (e *Editor) MoveCursorBackward() {
 	if e.Cursor.CurrentIndex == 0 {
 		return
 	}
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
 	clear(e.LastCursorPositions)
 	currentChar, _ := e.CurrentChar()
 	shouldGoToPreviousLine := e.Cursor.Column == 0 && e.Cursor.Line > 0
 	if shouldGoToPreviousLine {
 		e.LastLineVisited = e.Cursor.Line
 		previousLine, _ := e.PreviousLine()
-		newColumn := previousLine.Length
-		newCurrentIndex := previousLine.Start + previousLine.Length
-		if !previousLine.AutoNewLine {
-			newCurrentIndex--
-			newColumn--
-		}
+		lineBreakLength := e.LineBreakLength(e.Cursor.Line - 1)
+		newColumn := previousLine.Length - lineBreakLength
+		newCurrentIndex := previousLine.Start + previousLine.Length - lineBreakLength
 
 		newPosition := e.WritableRec.X + previousLine.Rectangle.Width
 		previousChar, _ := e.PieceTable.GetAt(uint(e.Cursor.CurrentIndex - 1))
@@ -622,10 +1371,18 @@ func (e *Editor) MoveCursorBackward() {
 			newColumn,
 		)
 	} else {
-		previousCharacter, _ := e.PreviousChar()
-		e.Cursor.Rectangle.X -= e.CharWidthWithSpacing(previousCharacter)
-		e.Cursor.CurrentIndex--
-		e.Cursor.Column--
+		// the cursor goes to the start of the cluster before it, which has the cluster's width
+		previous := int(e.PieceTable.PreviousGraphemeBoundary(uint(e.Cursor.CurrentIndex)))
+		previous = max(previous, e.CurrentLine().Start)
+		clusterStart, _ := e.PieceTable.GetAt(uint(previous))
+		e.Cursor.Column -= e.Cursor.CurrentIndex - previous
+		e.Cursor.CurrentIndex = previous
+		if clusterStart == '\t' {
+			// a tab's width depends on what's before it
+			e.Cursor.Rectangle.X = e.FindPositionByLineColumn(e.Cursor.Line, e.Cursor.Column)
+		} else {
+			e.Cursor.Rectangle.X -= e.CharWidthWithSpacing(clusterStart)
+		}
 	}
 	e.PreviousCharacter = currentChar
 }
@@ -635,7 +1392,6 @@ func (e *Editor) _internalMoveCursorBackwardOrDownward(direction int) {
 	var line *Line
 	var lastCursorPosition CursorPosition
 	var ok bool
-	var newCurrentIndex int
 	var newLine int
 	var shouldDecreaseColumnAndIndex bool = false
 
@@ -643,15 +1399,19 @@ func (e *Editor) _internalMoveCursorBackwardOrDownward(direction int) {
 		line, _ = e.PreviousLine()
 		lastCursorPosition, ok = e.LastCursorPositions[e.Cursor.Line-1]
 		newLine = e.Cursor.Line - 1
-		newCurrentIndex = e.Cursor.CurrentIndex - (e.Cursor.Column + line.Length - e.Cursor.Column)
 		shouldDecreaseColumnAndIndex = e.Cursor.Line-1 == 0 || !line.AutoNewLine
 	}
 	if direction == DOWNWARD {
 		line, _ = e.NextLine()
 		lastCursorPosition, ok = e.LastCursorPositions[e.Cursor.Line+1]
 		newLine = e.Cursor.Line + 1
-		newCurrentIndex = e.Cursor.CurrentIndex + (e.CurrentLine().Length - e.Cursor.Column + e.Cursor.Column)
-		shouldDecreaseColumnAndIndex = !line.AutoNewLine
+		shouldDecreaseColumnAndIndex = e.EndsWithLineBreak(newLine)
+	}
+	// the column is counted in clusters, a line with marks or joined emojis has more runes than columns
+	var column int
+	var inLine bool
+	if !ok {
+		column, inLine = e.FindColumnByClusters(newLine, e.ClusterColumn(e.Cursor.Line, e.Cursor.Column))
 	}
 	if ok {
 		e.Cursor.SetPosition(
@@ -661,7 +1421,7 @@ func (e *Editor) _internalMoveCursorBackwardOrDownward(direction int) {
 			newLine,
 			lastCursorPosition.Column,
 		)
-	} else if e.Cursor.Column >= line.Length {
+	} else if !inLine {
 		e.LastCursorPositions[e.Cursor.Line] = CursorPosition{
 			Position:     rl.Vector2{X: e.Cursor.Rectangle.X, Y: e.Cursor.Rectangle.Y},
 			Line:         e.Cursor.Line,
@@ -671,8 +1431,10 @@ func (e *Editor) _internalMoveCursorBackwardOrDownward(direction int) {
 		newColumn := line.Length
 		newCurrentIndex := line.Start + line.Length
 		if shouldDecreaseColumnAndIndex {
-			newColumn--
-			newCurrentIndex -= 1
+			// before the line break, which has two runes when it's a CRLF
+			lineBreakLength := max(e.LineBreakLength(newLine), 1)
+			newColumn -= lineBreakLength
+			newCurrentIndex -= lineBreakLength
 		}
 		e.Cursor.SetPosition(
 			newCurrentIndex,
@@ -682,36 +1444,88 @@ func (e *Editor) _internalMoveCursorBackwardOrDownward(direction int) {
 			newColumn,
 		)
 	} else {
-		newX := e.FindPositionByLineColumn(newLine, e.Cursor.Column)
+		newX := e.FindPositionByLineColumn(newLine, column)
 		e.Cursor.SetPosition(
-			newCurrentIndex,
+			line.Start+column,
 			newX,
 			line.Rectangle.Y,
 			newLine,
-			e.Cursor.Column,
+			column,
 		)
 	}
 }
 
+// how many clusters there are in the line before column
+func (e *Editor) ClusterColumn(lineIndex int, column int) int {
+	line := e.Lines[lineIndex]
+	column = min(column, line.Length)
+	if column <= 0 {
+		return 0
+	}
+	sequence, _, err := e.PieceTable.GetSequence(uint(line.Start), uint(column))
+	if err != nil {
+		return column
+	}
+	clusters := 0
+	var segmenter pt.GraphemeSegmenter
+	for _, char := range sequence.RuneForward() {
+		if segmenter.IsBoundary(char) {
+			clusters++
+		}
+	}
+	return clusters
+}
+
+// the column where the line's cluster number clusters starts, false when the line doesn't have that many clusters
+func (e *Editor) FindColumnByClusters(lineIndex int, clusters int) (int, bool) {
+	line := e.Lines[lineIndex]
+	if line.Length == 0 {
+		return 0, false
+	}
+	sequence, _, err := e.PieceTable.GetSequence(uint(line.Start), uint(line.Length))
+	if err != nil {
+		return 0, false
+	}
+	cluster := -1
+	var segmenter pt.GraphemeSegmenter
+	for column, char := range sequence.RuneForward() {
+		if !segmenter.IsBoundary(char) {
+			continue
+		}
+		cluster++
+		if cluster == clusters {
+			return column, true
+		}
+	}
+	return 0, false
+}
+
 func (e *Editor) MoveCursorUpward() {
 	if e.Cursor.Line == 0 {
 		return
 	}
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
 	e._internalMoveCursorBackwardOrDownward(UPWARD)
+	e.ScrollToCursor()
 }
 
 func (e *Editor) MoveCursorDownward() {
 	if e.Cursor.Line >= len(e.Lines)-1 {
 		return
 	}
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
 	e._internalMoveCursorBackwardOrDownward(DOWNWARD)
+	e.ScrollToCursor()
 }
 
 func (e *Editor) SetCursorPositionByClick(mouseClick rl.Vector2) error {
+	// lines are positioned on the whole text, not on the screen
+	mouseClick.Y += e.ScrollY
 	lineIndex, line, _, column, index, xPosition, previousChar, err := e.FindLineClickMetadata(mouseClick)
 	if err != nil {
 		return err
 	}
+	e.AddAction(MOUSE_LEFT_CLICK, e.Cursor.CurrentIndex)
 	e.LastLineVisited = e.Cursor.Line
 	clear(e.LastCursorPositions)
 	if line != nil {
@@ -729,10 +1543,6 @@ func (e *Editor) SetCursorPositionByClick(mouseClick rl.Vector2) error {
 		lastLine := e.LastLine()
 		index := lastLine.Start + lastLine.Length
 		column := lastLine.Length
-		if !lastLine.AutoNewLine {
-			index--
-			column--
-		}
 		previousChar, _ := e.PieceTable.GetAt(uint(index - 1))
 		e.PreviousCharacter = previousChar
 		xPosition := lastLine.Rectangle.X + lastLine.Rectangle.Width
@@ -747,14 +1557,999 @@ func (e *Editor) SetCursorPositionByClick(mouseClick rl.Vector2) error {
 	return nil
 }
 
+func (e *Editor) LastAction() Action {
+	if len(e.Actions) == 0 {
+		return NONE
+	}
+	return e.Actions[len(e.Actions)-1]
+}
+
+// Logs the action and keeps the undo group open while the same edit keeps going
+// at the same spot, like typing a word or holding backspace.
+// Anything else, or a pause, closes the group so it becomes a single undo step
+func (e *Editor) AddAction(action Action, index int) {
+	now := rl.GetTime()
+	isEdit := action == TYPING || action == DELETE
+	continuesGroup := isEdit &&
+		action == e.LastAction() &&
+		index == e.lastEditIndex &&
+		now-e.lastActionTime < UNDO_GROUP_PAUSE
+	if !continuesGroup {
+		e.endTypingGroup()
+	}
+	if isEdit && !e.typingGroupOpen {
+		e.PieceTable.BeginTransaction()
+		e.typingGroupOpen = true
+	}
+	e.Actions = append(e.Actions, action)
+	e.lastActionTime = now
+}
+
+// closes the undo group AddAction opened, a transaction someone else opened stays open
+// and the group's edits become part of it when it ends
+func (e *Editor) endTypingGroup() {
+	if !e.typingGroupOpen {
+		return
+	}
+	e.typingGroupOpen = false
+	e.PieceTable.EndTransaction()
+}
+
 func (e *Editor) Insert(index int, sequence pt.Sequence) {
-	size, _ := e.PieceTable.Insert(uint(index), sequence)
-	e.CalculateLines()
-	e.SetCursorPositionByIndex(index + int(size))
+	firstChar, _ := utf8.DecodeRune(sequence)
+	startsNewWord := unicode.IsSpace(e.lastTypedChar) && !unicode.IsSpace(firstChar)
+	if startsNewWord || sequence.RuneLength() > 1 {
+		e.endTypingGroup()
+	}
+	e.AddAction(TYPING, index)
+	e.insert(index, sequence)
 }
 
+// deletes length runes before index, like backspace does
 func (e *Editor) Delete(index int, length int) {
-	_ = e.PieceTable.Delete(uint(index-length), uint(length))
-	e.CalculateLines()
+	e.AddAction(DELETE, index)
+	e.delete(index, length)
+}
+
+// Insert and Delete without logging an action, so they can be combined in the same undo group
+func (e *Editor) insert(index int, sequence pt.Sequence) {
+	e.AddGlyphs(sequence)
+	size, err := e.PieceTable.Insert(uint(index), sequence)
+	if err != nil {
+		return
+	}
+	e.lastTypedChar, _ = utf8.DecodeLastRune(sequence)
+	e.lastEditIndex = index + int(size)
+	e.Selection = Selection{}
+	e.UpdateLines(index, int(size), 0)
+	e.SetCursorPositionByIndex(index + int(size))
+}
+
+func (e *Editor) delete(index int, length int) {
+	err := e.PieceTable.Delete(uint(index-length), uint(length))
+	if err != nil {
+		return
+	}
+	e.lastEditIndex = index - length
+	e.Selection = Selection{}
+	e.UpdateLines(index-length, 0, length)
 	e.SetCursorPositionByIndex(index - length)
 }
+
+// inserts sequence at the cursor, replacing the selection if there is one
+func (e *Editor) Type(sequence pt.Sequence) {
+	if e.HasExtraCursors() {
+		e.EditAtCursors(TYPING, func(int) pt.Sequence { return sequence }, nil)
+		return
+	}
+	if e.HasSelection() {
+		e.ReplaceSelection(sequence)
+		return
+	}
+	e.Insert(e.Cursor.CurrentIndex, sequence)
+}
+
+// deletes the selection if there is one, otherwise the cluster before the cursor
+func (e *Editor) Backspace() {
+	if e.HasExtraCursors() {
+		e.EditAtCursors(DELETE, nil, func(index int) (int, int) {
+			return int(e.PieceTable.PreviousGraphemeBoundary(uint(index))), index
+		})
+		return
+	}
+	if e.HasSelection() {
+		e.DeleteSelection()
+		return
+	}
+	index := e.Cursor.CurrentIndex
+	e.Delete(index, index-int(e.PieceTable.PreviousGraphemeBoundary(uint(index))))
+}
+
+// deletes the selection if there is one, otherwise the cluster after the cursor
+func (e *Editor) DeleteForward() {
+	if e.HasExtraCursors() {
+		e.EditAtCursors(DELETE, nil, func(index int) (int, int) {
+			return index, int(e.PieceTable.NextGraphemeBoundary(uint(index)))
+		})
+		return
+	}
+	if e.HasSelection() {
+		e.DeleteSelection()
+		return
+	}
+	index := e.Cursor.CurrentIndex
+	if index >= int(e.PieceTable.RuneLength) {
+		return
+	}
+	// the cursor stays at index, so deleting forward again continues the same undo group
+	next := int(e.PieceTable.NextGraphemeBoundary(uint(index)))
+	e.AddAction(DELETE, index)
+	e.delete(next, next-index)
+}
+
+// @words
+
+func (e *Editor) MoveWordForward() {
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
+	clear(e.LastCursorPositions)
+	e.SetCursorPositionByIndex(int(e.PieceTable.NextWordEnd(uint(e.Cursor.CurrentIndex))))
+}
+
+func (e *Editor) MoveWordBackward() {
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
+	clear(e.LastCursorPositions)
+	e.SetCursorPositionByIndex(int(e.PieceTable.PreviousWordStart(uint(e.Cursor.CurrentIndex))))
+}
+
+// deletes the selection if there is one, otherwise from the start of the word before the cursor up to it
+func (e *Editor) DeleteWordBackward() {
+	wordRange := func(index int) (int, int) {
+		return int(e.PieceTable.PreviousWordStart(uint(index))), index
+	}
+	if e.HasExtraCursors() {
+		e.EditAtCursors(DELETE, nil, wordRange)
+		return
+	}
+	if e.HasSelection() {
+		e.DeleteSelection()
+		return
+	}
+	start, end := wordRange(e.Cursor.CurrentIndex)
+	if start == end {
+		return
+	}
+	e.Delete(end, end-start)
+}
+
+// deletes the selection if there is one, otherwise from the cursor to the end of the word after it
+func (e *Editor) DeleteWordForward() {
+	wordRange := func(index int) (int, int) {
+		return index, int(e.PieceTable.NextWordEnd(uint(index)))
+	}
+	if e.HasExtraCursors() {
+		e.EditAtCursors(DELETE, nil, wordRange)
+		return
+	}
+	if e.HasSelection() {
+		e.DeleteSelection()
+		return
+	}
+	start, end := wordRange(e.Cursor.CurrentIndex)
+	if start == end {
+		return
+	}
+	e.AddAction(DELETE, start)
+	e.delete(end, end-start)
+}
+
+func (e *Editor) InsertNewLine() {
+	e.Type(e.LineBreak())
+}
+
+// A tab, or when InsertSpaces is set the spaces up to the next tab stop, which every cursor counts from where it is
+func (e *Editor) InsertTab() {
+	if !e.InsertSpaces {
+		e.Type(pt.Sequence("\t"))
+		return
+	}
+	if e.HasExtraCursors() {
+		e.EditAtCursors(TYPING, e.TabSpaces, nil)
+		return
+	}
+	index := e.Cursor.CurrentIndex
+	if e.HasSelection() {
+		index = e.Selection.Start()
+	}
+	e.Type(e.TabSpaces(index))
+}
+
+// the spaces that go from index to the next tab stop
+func (e *Editor) TabSpaces(index int) pt.Sequence {
+	spaces := math.Round(float64(e.TabWidthAt(e.ParagraphXAt(index)) / e.CharWidthWithSpacing(' ')))
+	return pt.Sequence(strings.Repeat(" ", max(int(spaces), 1)))
+}
+
+// -1 is never where the last edit was, so the selection always starts a new undo group
+func (e *Editor) DeleteSelection() {
+	if !e.HasSelection() {
+		return
+	}
+	e.AddAction(DELETE, -1)
+	e.delete(e.Selection.End(), e.Selection.Length())
+}
+
+// the deletion and the insertion are undone together
+func (e *Editor) ReplaceSelection(sequence pt.Sequence) {
+	if !e.HasSelection() {
+		return
+	}
+	start := e.Selection.Start()
+	e.AddAction(TYPING, -1)
+	e.delete(e.Selection.End(), e.Selection.Length())
+	e.insert(start, sequence)
+}
+
+func (e *Editor) Undo() {
+	// the typing group ends here, edits after this are a new step
+	e.endTypingGroup()
+	if history := e.PieceTable.History; len(history.UndoStack) > 0 {
+		// a line ending conversion changed the whole text, the cursor stays where it was
+		if endings, ok := e.lineEndingChanges[history.UndoStack[len(history.UndoStack)-1].ID]; ok {
+			e.keepParagraphColumn(func() { e.PieceTable.Undo() })
+			e.LineEnding = endings[0]
+			return
+		}
+	}
+	transaction, err := e.PieceTable.Undo()
+	if err != nil {
+		return
+	}
+	e.ExtraCursors = e.ExtraCursors[:0]
+	e.Selection = Selection{}
+	e.CalculateLines()
+	// the cursor goes back to where the first change of the group happened.
+	// undoing a delete brings the text back, so the cursor goes after it as if it was never deleted
+	change := transaction.Changes[0]
+	index := change.Position
+	if change.Type == pt.DELETE {
+		index += change.RuneLength
+	}
+	e.SetCursorPositionByIndex(int(index))
+}
+
+func (e *Editor) Redo() {
+	// the typing group ends here, edits after this are a new step
+	e.endTypingGroup()
+	if history := e.PieceTable.History; len(history.RedoStack) > 0 {
+		if endings, ok := e.lineEndingChanges[history.RedoStack[len(history.RedoStack)-1].ID]; ok {
+			e.keepParagraphColumn(func() { e.PieceTable.Redo() })
+			e.LineEnding = endings[1]
+			return
+		}
+	}
+	transaction, err := e.PieceTable.Redo()
+	if err != nil {
+		return
+	}
+	e.ExtraCursors = e.ExtraCursors[:0]
+	e.Selection = Selection{}
+	e.CalculateLines()
+	change := transaction.Changes[len(transaction.Changes)-1]
+	index := change.Position
+	if change.Type == pt.INSERT {
+		index += change.RuneLength
+	}
+	e.SetCursorPositionByIndex(int(index))
+}
+
+// @line movement
+// Home and End go to the start and end of the line on the screen, the paragraph ones
+// ignore wrapping and go to the start and end of the line in the text
+
+func (e *Editor) MoveToLineStart() {
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
+	clear(e.LastCursorPositions)
+	e.SetCursorPositionByIndex(e.CurrentLine().Start)
+}
+
+func (e *Editor) MoveToLineEnd() {
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
+	clear(e.LastCursorPositions)
+	lineIndex := e.Cursor.Line
+	line := e.CurrentLine()
+	index := line.Start + line.Length
+	if e.EndsWithLineBreak(lineIndex) {
+		e.SetCursorPositionByIndex(index - e.LineBreakLength(lineIndex))
+		return
+	}
+	if !line.AutoNewLine {
+		e.SetCursorPositionByIndex(index)
+		return
+	}
+	// a wrapped line ends where the next one starts, looking the index up would go to the next line.
+	// Like MoveCursorBackward, the cursor stays before the space the line was wrapped at
+	column := line.Length
+	x := line.Rectangle.X + line.Rectangle.Width
+	lastChar, _ := e.PieceTable.GetAt(uint(index - 1))
+	if lastChar == ' ' {
+		index--
+		column--
+		x -= e.CharWidthWithSpacing(lastChar)
+	}
+	e.LastLineVisited = e.Cursor.Line
+	e.PreviousCharacter, _ = e.PieceTable.GetAt(uint(index - 1))
+	e.Cursor.SetPosition(index, x, line.Rectangle.Y, lineIndex, column)
+	e.ScrollToCursor()
+}
+
+func (e *Editor) MoveToParagraphStart() {
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
+	clear(e.LastCursorPositions)
+	paragraph, err := e.PieceTable.LineOfOffset(uint(e.Cursor.CurrentIndex))
+	if err != nil {
+		return
+	}
+	start, err := e.PieceTable.LineStart(paragraph)
+	if err != nil {
+		return
+	}
+	e.SetCursorPositionByIndex(int(start))
+}
+
+func (e *Editor) MoveToParagraphEnd() {
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
+	clear(e.LastCursorPositions)
+	paragraph, err := e.PieceTable.LineOfOffset(uint(e.Cursor.CurrentIndex))
+	if err != nil {
+		return
+	}
+	end, err := e.PieceTable.LineEnd(paragraph)
+	if err != nil {
+		return
+	}
+	e.SetCursorPositionByIndex(int(end))
+}
+
+func (e *Editor) MoveToTextStart() {
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
+	clear(e.LastCursorPositions)
+	e.SetCursorPositionByIndex(0)
+}
+
+func (e *Editor) MoveToTextEnd() {
+	e.AddAction(CURSOR_MOVE, e.Cursor.CurrentIndex)
+	clear(e.LastCursorPositions)
+	e.SetCursorPositionByIndex(int(e.PieceTable.RuneLength))
+}
+
+// @selection
+
+func (e *Editor) HasSelection() bool {
+	return !e.Selection.IsEmpty()
+}
+
+func (e *Editor) SetSelection(selection Selection) {
+	if selection == e.Selection {
+		return
+	}
+	e.Selection = selection
+	e._updateRenderTexture()
+}
+
+func (e *Editor) ClearSelection() {
+	e.SetSelection(Selection{})
+}
+
+func (e *Editor) SelectAll() {
+	e.ExtraCursors = e.ExtraCursors[:0]
+	e.SetCursorPositionByIndex(int(e.PieceTable.RuneLength))
+	e.SetSelection(Selection{Anchor: 0, Head: e.Cursor.CurrentIndex})
+}
+
+// moves every cursor with move. When extend is true the selection goes from
+// where it was anchored (or where the cursor was) to where the cursor ends up,
+// otherwise the selection is dropped
+func (e *Editor) MoveCursor(move func(), extend bool) {
+	e.ForEachCursor(func() {
+		anchor := e.Cursor.CurrentIndex
+		if e.HasSelection() {
+			anchor = e.Selection.Anchor
+		}
+		move()
+		if extend {
+			e.SetSelection(Selection{Anchor: anchor, Head: e.Cursor.CurrentIndex})
+		} else {
+			e.ClearSelection()
+		}
+	})
+}
+
+// puts the cursor where the mouse is and starts selecting from there,
+// or from the current selection's anchor when extend is true
+func (e *Editor) StartSelectionDrag(mouse rl.Vector2, extend bool) error {
+	anchor := e.Cursor.CurrentIndex
+	if e.HasSelection() {
+		anchor = e.Selection.Anchor
+	}
+	err := e.SetCursorPositionByClick(mouse)
+	if err != nil {
+		return err
+	}
+	if !extend {
+		anchor = e.Cursor.CurrentIndex
+	}
+	e.ExtraCursors = e.ExtraCursors[:0]
+	e.selecting = true
+	e.lastDragMouse = mouse
+	e.SetSelection(Selection{Anchor: anchor, Head: e.Cursor.CurrentIndex})
+	return nil
+}
+
+// moves the selection's head to the mouse, scrolling when the mouse is above or below the editor
+func (e *Editor) DragSelection(mouse rl.Vector2) error {
+	if !e.selecting {
+		return nil
+	}
+	top := e.EditorRec.Y
+	bottom := e.EditorRec.Y + e.EditorRec.Height - 1
+	scrolled := false
+	if mouse.Y < top || mouse.Y > bottom {
+		scrollY := e.ScrollY
+		e.ScrollBy((mouse.Y - max(top, min(mouse.Y, bottom))) * DRAG_SCROLL_FACTOR)
+		scrolled = scrollY != e.ScrollY
+	}
+	if mouse == e.lastDragMouse && !scrolled {
+		return nil
+	}
+	e.lastDragMouse = mouse
+	mouse.Y = max(top, min(mouse.Y, bottom))
+	anchor := e.Selection.Anchor
+	err := e.SetCursorPositionByClick(mouse)
+	if err != nil {
+		return err
+	}
+	e.SetSelection(Selection{Anchor: anchor, Head: e.Cursor.CurrentIndex})
+	return nil
+}
+
+func (e *Editor) StopSelectionDrag() {
+	e.selecting = false
+}
+
+// @cursors
+// Every extra cursor is moved by swapping it into the Editor's fields and running the same
+// code the main cursor uses, so there's a single implementation of every movement
+
+func (e *Editor) HasExtraCursors() bool {
+	return len(e.ExtraCursors) > 0
+}
+
+func (e *Editor) ClearExtraCursors() {
+	if !e.HasExtraCursors() {
+		return
+	}
+	e.ExtraCursors = e.ExtraCursors[:0]
+	e._updateRenderTexture()
+}
+
+// the main cursor as an ExtraCursor, to be kept when a new main cursor is placed
+func (e *Editor) saveCursor() ExtraCursor {
+	return ExtraCursor{
+		Cursor:              e.Cursor,
+		Selection:           e.Selection,
+		PreviousCharacter:   e.PreviousCharacter,
+		LastLineVisited:     e.LastLineVisited,
+		LastCursorPositions: maps.Clone(e.LastCursorPositions),
+	}
+}
+
+func (e *Editor) swapCursor(extra *ExtraCursor) {
+	e.Cursor, extra.Cursor = extra.Cursor, e.Cursor
+	e.Selection, extra.Selection = extra.Selection, e.Selection
+	e.PreviousCharacter, extra.PreviousCharacter = extra.PreviousCharacter, e.PreviousCharacter
+	e.LastLineVisited, extra.LastLineVisited = extra.LastLineVisited, e.LastLineVisited
+	e.LastCursorPositions, extra.LastCursorPositions = extra.LastCursorPositions, e.LastCursorPositions
+}
+
+// runs fn once for every cursor, as if it was the main one. The main cursor goes last
+// and the scroll only follows it, then the cursors that ended up together are merged
+func (e *Editor) ForEachCursor(fn func()) {
+	e.renderPaused = true
+	scrollY := e.ScrollY
+	for i := range e.ExtraCursors {
+		e.swapCursor(&e.ExtraCursors[i])
+		fn()
+		e.swapCursor(&e.ExtraCursors[i])
+	}
+	e.SetScroll(scrollY)
+	fn()
+	e.MergeCursors()
+	e.resumeRender()
+}
+
+func (e *Editor) resumeRender() {
+	e.renderPaused = false
+	if e.renderPending {
+		e.renderPending = false
+		e._updateRenderTexture()
+	}
+}
+
+// the selection of every cursor, the main one first
+func (e *Editor) Selections() []Selection {
+	selections := make([]Selection, 0, len(e.ExtraCursors)+1)
+	selections = append(selections, e.Selection)
+	for _, extra := range e.ExtraCursors {
+		selections = append(selections, extra.Selection)
+	}
+	return selections
+}
+
+// what a cursor covers: its selection, or just where it is
+func cursorRange(cursor Cursor, selection Selection) (int, int) {
+	if selection.IsEmpty() {
+		return cursor.CurrentIndex, cursor.CurrentIndex
+	}
+	return selection.Start(), selection.End()
+}
+
+// drops the extra cursors that are at the same place as another cursor or overlap its selection.
+// The main cursor is always kept
+func (e *Editor) MergeCursors() {
+	type span struct{ start, end int }
+	overlaps := func(a span, b span) bool {
+		return a.start == b.start && a.end == b.end || a.start < b.end && b.start < a.end
+	}
+	start, end := cursorRange(e.Cursor, e.Selection)
+	kept := []span{{start, end}}
+	extras := e.ExtraCursors[:0]
+	for _, extra := range e.ExtraCursors {
+		start, end := cursorRange(extra.Cursor, extra.Selection)
+		current := span{start, end}
+		if slices.ContainsFunc(kept, func(other span) bool { return overlaps(current, other) }) {
+			continue
+		}
+		kept = append(kept, current)
+		extras = append(extras, extra)
+	}
+	if len(extras) != len(e.ExtraCursors) {
+		e._updateRenderTexture()
+	}
+	e.ExtraCursors = extras
+}
+
+// keeps the current cursor and puts the main one where the mouse is
+func (e *Editor) AddCursorAtClick(mouse rl.Vector2) error {
+	extra := e.saveCursor()
+	err := e.SetCursorPositionByClick(mouse)
+	if err != nil {
+		return err
+	}
+	e.ExtraCursors = append(e.ExtraCursors, extra)
+	e.Selection = Selection{}
+	e.MergeCursors()
+	e._updateRenderTexture()
+	return nil
+}
+
+// rune offset to byte offset in text
+func byteOffset(text pt.Sequence, runeOffset int) int {
+	offset := 0
+	for range runeOffset {
+		if offset >= len(text) {
+			break
+		}
+		_, size := utf8.DecodeRune(text[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// selects the next occurrence of the main selection with a new main cursor, wrapping around
+// at the end of the text. Occurrences another cursor already selects are skipped
+func (e *Editor) SelectNextOccurrence() {
+	if !e.HasSelection() {
+		return
+	}
+	selected, err := e.SelectedText()
+	if err != nil || len(selected) == 0 {
+		return
+	}
+	text := e.PieceTable.Bytes()
+	from := byteOffset(text, e.Selection.End())
+	length := e.Selection.Length()
+	for range len(e.ExtraCursors) + 1 {
+		index := bytes.Index(text[from:], selected)
+		if index == -1 {
+			index = bytes.Index(text, selected)
+		} else {
+			index += from
+		}
+		if index == -1 {
+			return
+		}
+		start := utf8.RuneCount(text[:index])
+		occurrence := Selection{Anchor: start, Head: start + length}
+		if !slices.ContainsFunc(e.Selections(), func(s Selection) bool {
+			return s.Start() == occurrence.Start() && s.End() == occurrence.End()
+		}) {
+			e.ExtraCursors = append(e.ExtraCursors, e.saveCursor())
+			e.SetCursorPositionByIndex(occurrence.Head)
+			e.SetSelection(occurrence)
+			return
+		}
+		from = index + len(selected)
+		if from >= len(text) {
+			from = 0
+		}
+	}
+}
+
+// Applies the same edit at every cursor as a single undo step: each cursor's selection is replaced
+// with what sequenceAt gives for where the edit starts, or it's inserted at the cursor when it has none
+// (a nil sequenceAt inserts nothing, and when deleteRange isn't nil, the range it returns for the cursor's
+// index is deleted first, like backspace does with the char before it).
+// The edits go from the last one to the first, so the offsets of the ones still to be applied
+// stay valid, then every cursor is moved by what the edits before it inserted and deleted
+func (e *Editor) EditAtCursors(action Action, sequenceAt func(index int) pt.Sequence, deleteRange func(index int) (int, int)) {
+	type cursorEdit struct {
+		cursor     int // index in ExtraCursors, -1 for the main cursor
+		start, end int
+		sequence   pt.Sequence
+	}
+	edits := make([]cursorEdit, 0, len(e.ExtraCursors)+1)
+	addEdit := func(cursorIndex int, cursor Cursor, selection Selection) {
+		start, end := cursorRange(cursor, selection)
+		if selection.IsEmpty() && deleteRange != nil {
+			start, end = deleteRange(cursor.CurrentIndex)
+		}
+		edits = append(edits, cursorEdit{cursorIndex, start, end, nil})
+	}
+	for i, extra := range e.ExtraCursors {
+		addEdit(i, extra.Cursor, extra.Selection)
+	}
+	addEdit(-1, e.Cursor, e.Selection)
+	sort.Slice(edits, func(i int, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	// deleting at a cursor right next to another one's selection would delete twice
+	for i := 1; i < len(edits); i++ {
+		edits[i].start = max(edits[i].start, edits[i-1].end)
+		edits[i].end = max(edits[i].end, edits[i].start)
+	}
+	// every sequence is made from the text before any edit
+	if sequenceAt != nil {
+		for i := range edits {
+			edits[i].sequence = sequenceAt(edits[i].start)
+			e.AddGlyphs(edits[i].sequence)
+		}
+	}
+
+	e.AddAction(action, e.Cursor.CurrentIndex)
+	e.renderPaused = true
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		// a selection replaced by the sequence is laid out once, after both edits
+		inserted, deleted := 0, 0
+		if edit.end > edit.start {
+			err := e.PieceTable.Delete(uint(edit.start), uint(edit.end-edit.start))
+			if err == nil {
+				deleted = edit.end - edit.start
+			}
+		}
+		if len(edit.sequence) > 0 {
+			size, err := e.PieceTable.Insert(uint(edit.start), edit.sequence)
+			if err == nil {
+				inserted = int(size)
+			}
+		}
+		if inserted > 0 || deleted > 0 {
+			e.UpdateLines(edit.start, inserted, deleted)
+		}
+	}
+
+	shift := 0
+	scrollY := e.ScrollY
+	for _, edit := range edits {
+		inserted := edit.sequence.RuneLength()
+		index := edit.start + shift + inserted
+		shift += inserted - (edit.end - edit.start)
+		if edit.cursor == -1 {
+			e.lastEditIndex = index
+			if len(edit.sequence) > 0 {
+				e.lastTypedChar, _ = utf8.DecodeLastRune(edit.sequence)
+			}
+			continue
+		}
+		extra := &e.ExtraCursors[edit.cursor]
+		e.swapCursor(extra)
+		e.Selection = Selection{}
+		e.SetCursorPositionByIndex(index)
+		e.swapCursor(extra)
+	}
+	e.SetScroll(scrollY)
+	e.Selection = Selection{}
+	e.SetCursorPositionByIndex(e.lastEditIndex)
+	e.MergeCursors()
+	e.resumeRender()
+}
+
+// @clipboard
+
+func (e *Editor) SelectedText() (pt.Sequence, error) {
+	if !e.HasSelection() {
+		return pt.Sequence{}, nil
+	}
+	sequence, _, err := e.PieceTable.GetSequence(uint(e.Selection.Start()), uint(e.Selection.Length()))
+	return sequence, err
+}
+
+func (e *Editor) Copy() error {
+	if !e.HasSelection() {
+		return nil
+	}
+	text, err := e.SelectedText()
+	if err != nil {
+		return err
+	}
+	rl.SetClipboardText(string(text))
+	return nil
+}
+
+func (e *Editor) Cut() error {
+	err := e.Copy()
+	if err != nil {
+		return err
+	}
+	e.DeleteSelection()
+	return nil
+}
+
+// Inserts the clipboard's text at every cursor with a single Insert, however many lines it has,
+// and the selection it replaces is laid out in the same pass, so only the pasted paragraphs are laid out.
+// A paste is always its own undo step, and its line breaks are written like the typed ones
+func (e *Editor) Paste() {
+	sequence, _ := pt.NormalizeLineEndings(pt.Sequence(rl.GetClipboardText()))
+	if e.LineEnding == pt.CRLF {
+		sequence = pt.ConvertLineEndings(sequence, pt.CRLF)
+	}
+	if len(sequence) == 0 {
+		return
+	}
+	e.endTypingGroup()
+	e.EditAtCursors(TYPING, func(int) pt.Sequence { return sequence }, nil)
+	e.endTypingGroup()
+}
+
+// @file
+
+// the text differs from what is on disk (or it was never saved)
+func (e *Editor) IsDirty() bool {
+	return e.PieceTable.IsModified() || e.LineEnding != e.savedLineEnding
+}
+
+// @line endings
+// The text keeps the bytes of its file, whatever line endings it has, and it's saved as it is.
+// LineEnding is only how the new line breaks are written, and the text changes its line breaks
+// when it's converted. With CR the text holds '\n' line breaks and they are written as CR when it's saved
+
+// the line break that is typed
+func (e *Editor) LineBreak() pt.Sequence {
+	if e.LineEnding == pt.CRLF {
+		return pt.Sequence("\r\n")
+	}
+	return pt.Sequence("\n")
+}
+
+// Converts every line break of the text to ending (a lone CR in a line too) as a single undo step,
+// the cursor stays in its paragraph
+func (e *Editor) SetLineEnding(ending pt.LineEnding) {
+	previous := e.LineEnding
+	content := e.PieceTable.Bytes()
+	converted, _ := pt.NormalizeLineEndings(content)
+	if ending == pt.CRLF {
+		converted = pt.ConvertLineEndings(converted, pt.CRLF)
+	}
+	if bytes.Equal(content, converted) {
+		if ending == previous {
+			return
+		}
+		// only the line ending typed from now on changes, it's still a step that can be undone
+		e.endTypingGroup()
+		e.LineEnding = ending
+		e.lineEndingChanges[e.PieceTable.RecordStep()] = [2]pt.LineEnding{previous, ending}
+		return
+	}
+	e.LineEnding = ending
+	e.keepParagraphColumn(func() {
+		// the conversion is its own step even inside a transaction someone else opened,
+		// so the undo stack's top is always the conversion
+		e.endTypingGroup()
+		e.PieceTable.CommitTransaction()
+		e.PieceTable.BeginTransaction()
+		e.PieceTable.Delete(0, e.PieceTable.RuneLength)
+		e.PieceTable.Insert(0, converted)
+		e.PieceTable.EndTransaction()
+		e.PieceTable.CommitTransaction()
+	})
+	undoStack := e.PieceTable.History.UndoStack
+	e.lineEndingChanges[undoStack[len(undoStack)-1].ID] = [2]pt.LineEnding{previous, ending}
+}
+
+// runs change, which can change the whole text, and puts the cursor back
+// in the same paragraph and column (or the paragraph's end if it's shorter now)
+func (e *Editor) keepParagraphColumn(change func()) {
+	paragraph, err := e.PieceTable.LineOfOffset(uint(e.Cursor.CurrentIndex))
+	if err != nil {
+		paragraph = 0
+	}
+	start, _ := e.PieceTable.LineStart(paragraph)
+	column := uint(e.Cursor.CurrentIndex) - start
+	change()
+	e.ExtraCursors = e.ExtraCursors[:0]
+	e.Selection = Selection{}
+	e.CalculateLines()
+	paragraph = min(paragraph, e.PieceTable.LineCount()-1)
+	start, _ = e.PieceTable.LineStart(paragraph)
+	end, _ := e.PieceTable.LineEnd(paragraph)
+	e.SetCursorPositionByIndex(int(min(start+column, end)))
+}
+
+func (e *Editor) Save() error {
+	if e.FilePath == "" {
+		return fmt.Errorf("Save: error trying to save. the text has no file, use SaveAs")
+	}
+	return e.SaveAs(e.FilePath)
+}
+
+// writes the text to path and makes it the editor's file from now on
+func (e *Editor) SaveAs(path string) error {
+	content := e.PieceTable.Bytes()
+	if e.LineEnding == pt.CR {
+		content = pt.ConvertLineEndings(content, pt.CR)
+	}
+	err := utils.WriteFileAtomic(path, content)
+	if err != nil {
+		return fmt.Errorf("SaveAs: error trying to save %s: %w", path, err)
+	}
+	e.FilePath = path
+	e.savedLineEnding = e.LineEnding
+	e.PieceTable.MarkSaved()
+	return nil
+}
+
+// @scroll
+
+func (e *Editor) ContentHeight() float32 {
+	lastLine := e.LastLine()
+	return lastLine.Rectangle.Y + lastLine.Rectangle.Height - e.WritableRec.Y
+}
+
+func (e *Editor) MaxScroll() float32 {
+	return max(0, e.ContentHeight()-e.EditorRec.Height)
+}
+
+func (e *Editor) ClampScroll(y float32) float32 {
+	return max(0, min(y, e.MaxScroll()))
+}
+
+func (e *Editor) SetScroll(y float32) {
+	y = e.ClampScroll(y)
+	if y == e.ScrollY {
+		return
+	}
+	e.ScrollY = y
+	e._updateRenderTexture()
+}
+
+func (e *Editor) ScrollBy(amount float32) {
+	e.SetScroll(e.ScrollY + amount)
+}
+
+// scrolls just enough for the cursor to be inside the editor
+func (e *Editor) ScrollToCursor() {
+	cursorTop := e.Cursor.Rectangle.Y - e.EditorRec.Y
+	cursorBottom := e.Cursor.Rectangle.Y + e.CurrentLine().Rectangle.Height - e.EditorRec.Y
+	if cursorTop < e.ScrollY {
+		e.SetScroll(cursorTop)
+	} else if cursorBottom > e.ScrollY+e.EditorRec.Height {
+		e.SetScroll(cursorBottom - e.EditorRec.Height)
+	}
+}
+
+// how many lines fit in the editor going from the cursor's line in direction,
+// lines can have different heights so they're added up until the page is full
+func (e *Editor) LinesPerPage(direction int) int {
+	var height float32
+	count := 0
+	for i := e.Cursor.Line + direction; i >= 0 && i < len(e.Lines); i += direction {
+		height += e.Lines[i].Rectangle.Height
+		if height > e.EditorRec.Height {
+			break
+		}
+		count++
+	}
+	return max(1, count)
+}
+
+func (e *Editor) PageUp() {
+	e.ScrollBy(-e.EditorRec.Height)
+	for range e.LinesPerPage(UPWARD) {
+		e.MoveCursorUpward()
+	}
+}
+
+func (e *Editor) PageDown() {
+	e.ScrollBy(e.EditorRec.Height)
+	for range e.LinesPerPage(DOWNWARD) {
+		e.MoveCursorDownward()
+	}
+}
+
+// the scrollbar's track, on the editor's right side
+func (e *Editor) ScrollbarRectangle() rl.Rectangle {
+	return rl.NewRectangle(
+		e.EditorRec.X+e.EditorRec.Width-SCROLLBAR_WIDTH,
+		e.EditorRec.Y,
+		SCROLLBAR_WIDTH,
+		e.EditorRec.Height,
+	)
+}
+
+// the part of the scrollbar representing what's visible
+func (e *Editor) ScrollbarThumb() rl.Rectangle {
+	track := e.ScrollbarRectangle()
+	visibleRatio := e.EditorRec.Height / (e.MaxScroll() + e.EditorRec.Height)
+	thumbHeight := max(track.Height*visibleRatio, SCROLLBAR_WIDTH*2)
+	var scrollRatio float32
+	if e.MaxScroll() > 0 {
+		scrollRatio = e.ScrollY / e.MaxScroll()
+	}
+	return rl.NewRectangle(track.X, track.Y+(track.Height-thumbHeight)*scrollRatio, track.Width, thumbHeight)
+}
+
+func (e *Editor) HasScrollbar() bool {
+	return e.MaxScroll() > 0
+}
+
+// returns true if the click was on the scrollbar, so it shouldn't move the cursor.
+// Clicking outside the thumb jumps to that place
+func (e *Editor) StartScrollbarDrag(mouse rl.Vector2) bool {
+	if !e.HasScrollbar() || !rl.CheckCollisionPointRec(mouse, e.ScrollbarRectangle()) {
+		return false
+	}
+	thumb := e.ScrollbarThumb()
+	e.scrollbarGrabY = thumb.Height / 2
+	if rl.CheckCollisionPointRec(mouse, thumb) {
+		e.scrollbarGrabY = mouse.Y - thumb.Y
+	}
+	e.scrollbarDragging = true
+	e.DragScrollbar(mouse)
+	return true
+}
+
+func (e *Editor) DragScrollbar(mouse rl.Vector2) {
+	if !e.scrollbarDragging {
+		return
+	}
+	track := e.ScrollbarRectangle()
+	thumb := e.ScrollbarThumb()
+	freeSpace := track.Height - thumb.Height
+	if freeSpace <= 0 {
+		return
+	}
+	ratio := (mouse.Y - e.scrollbarGrabY - track.Y) / freeSpace
+	e.SetScroll(ratio * e.MaxScroll())
+}
+
+func (e *Editor) StopScrollbarDrag() {
+	e.scrollbarDragging = false
+}
+
+func (e *Editor) DrawScrollbar() {
+	if !e.HasScrollbar() {
+		return
+	}
+	rl.DrawRectangleRec(e.ScrollbarRectangle(), rl.Color(e.Theme.Scrollbar))
+	rl.DrawRectangleRec(e.ScrollbarThumb(), rl.Color(e.Theme.ScrollbarThumb))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	pt "main/piece-table"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// the editor needs a raylib window for its fonts and render texture, the tests open a hidden one
+func TestMain(m *testing.M) {
+	rl.SetTraceLogLevel(rl.LogNone)
+	rl.SetConfigFlags(rl.FlagWindowHidden)
+	rl.InitWindow(800, 600, "editor tests")
+	code := m.Run()
+	rl.CloseWindow()
+	os.Exit(code)
+}
+
+func newTestEditor(text string) *Editor {
+	editor := NewEditor(rl.NewRectangle(0, 0, 400, 600), DARK_THEME)
+	table := pt.NewPieceTable(pt.Sequence(text), pt.WithPieceTree())
+	editor.PieceTable = &table
+	editor.CalculateLines()
+	return &editor
+}
+
+func linesString(lines []*Line) string {
+	var s string
+	for _, line := range lines {
+		s += fmt.Sprintf("%d+%d %v %v %v %v|", line.Start, line.Length, line.Rectangle, line.AutoNewLine, line.ParagraphX, line.Ascent)
+	}
+	return s
+}
+
+// the lines UpdateLines leaves after each edit must be the ones a full layout gives
+func TestLayoutIncremental(t *testing.T) {
+	alphabet := []rune("ab cdefg\n\t  xyzé")
+	for seed := int64(0); seed < 100; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		e := newTestEditor("hello world this is a long line that wraps around the editor width for sure\nshort\n\nx\n")
+		for step := range 80 {
+			length := int(e.PieceTable.RuneLength)
+			// half of the edits are where a line starts, which is where the wrapping changes
+			position := random.Intn(length + 1)
+			if random.Intn(2) == 0 {
+				position = e.Lines[random.Intn(len(e.Lines))].Start
+			}
+			if random.Intn(2) == 0 || length == 0 {
+				runes := make([]rune, 1+random.Intn(4))
+				for i := range runes {
+					runes[i] = alphabet[random.Intn(len(alphabet))]
+				}
+				e.Insert(position, pt.Sequence(string(runes)))
+			} else {
+				position = max(position, 1)
+				e.Delete(position, 1+random.Intn(min(position, 5)))
+			}
+			got := linesString(e.Lines)
+			e.CalculateLines()
+			if want := linesString(e.Lines); got != want {
+				t.Fatalf("seed %d step %d, the text is %q\n got %s\nwant %s", seed, step, e.PieceTable.ToString(), got, want)
+			}
+		}
+	}
+}
+
+func TestOuterTransactionWrapsTypingAndPaste(t *testing.T) {
+	e := newTestEditor("abc\n")
+	e.SetCursorPositionByIndex(3)
+	e.PieceTable.BeginTransaction()
+	for _, char := range " word" {
+		e.Type(pt.Sequence(string(char)))
+	}
+	rl.SetClipboardText("pasted\ntext")
+	e.Paste()
+	if !e.PieceTable.InTransaction() {
+		t.Fatal("the editor closed a transaction it didn't open")
+	}
+	e.PieceTable.EndTransaction()
+	if e.PieceTable.InTransaction() {
+		t.Fatal("the typing group was left open")
+	}
+	if e.PieceTable.ToString() != "abc wordpasted\ntext\n" {
+		t.Fatalf("the text is %q", e.PieceTable.ToString())
+	}
+	e.Undo()
+	if e.PieceTable.ToString() != "abc\n" {
+		t.Fatalf("one undo left %q", e.PieceTable.ToString())
+	}
+	e.Redo()
+	if e.PieceTable.ToString() != "abc wordpasted\ntext\n" {
+		t.Fatalf("redo gave %q", e.PieceTable.ToString())
+	}
+}
+
+func TestSetLineEndingInsideTransaction(t *testing.T) {
+	e := newTestEditor("a\nb\n")
+	e.SetCursorPositionByIndex(1)
+	e.PieceTable.BeginTransaction()
+	e.Type(pt.Sequence("x"))
+	e.SetLineEnding(pt.CRLF)
+	e.PieceTable.EndTransaction()
+	if e.PieceTable.ToString() != "ax\r\nb\r\n" {
+		t.Fatalf("the text is %q", e.PieceTable.ToString())
+	}
+	// the conversion is its own step, undoing it gives the line ending back
+	e.Undo()
+	if e.PieceTable.ToString() != "ax\nb\n" || e.LineEnding != pt.LF {
+		t.Fatalf("undo left %q with %s", e.PieceTable.ToString(), pt.LINE_ENDING_NAMES[e.LineEnding])
+	}
+	e.Undo()
+	if e.PieceTable.ToString() != "a\nb\n" {
+		t.Fatalf("the second undo left %q", e.PieceTable.ToString())
+	}
+}
+
+// a text without line breaks only changes the line ending that is typed, it's still undone like a conversion
+func TestSetLineEndingWithoutLineBreaks(t *testing.T) {
+	e := newTestEditor("abc")
+	e.SetLineEnding(pt.CRLF)
+	if e.LineEnding != pt.CRLF || !e.PieceTable.CanUndo() {
+		t.Fatalf("the line ending is %s and the change can't be undone", pt.LINE_ENDING_NAMES[e.LineEnding])
+	}
+	e.Undo()
+	if e.LineEnding != pt.LF || e.PieceTable.ToString() != "abc" {
+		t.Fatalf("undo left %q with %s", e.PieceTable.ToString(), pt.LINE_ENDING_NAMES[e.LineEnding])
+	}
+	e.Redo()
+	if e.LineEnding != pt.CRLF || e.PieceTable.ToString() != "abc" {
+		t.Fatalf("redo left %q with %s", e.PieceTable.ToString(), pt.LINE_ENDING_NAMES[e.LineEnding])
+	}
+	e.SetLineEnding(pt.CRLF)
+	if len(e.PieceTable.History.UndoStack) != 1 {
+		t.Fatal("setting the same line ending again added a step")
+	}
+}
+
+// the extra cursors keep their indexes, only where they're drawn changes with the wrapping
+func TestRelayoutKeepsExtraCursors(t *testing.T) {
+	e := newTestEditor("one two three four five six seven eight nine ten eleven twelve thirteen fourteen\nsecond line\n")
+	for _, index := range []int{5, 60} {
+		e.SetCursorPositionByIndex(index)
+		e.ExtraCursors = append(e.ExtraCursors, e.saveCursor())
+	}
+	e.SetCursorPositionByIndex(85)
+	e.SetFontSize(e.FontSize * 2)
+	e.Relayout()
+	if len(e.ExtraCursors) != 2 {
+		t.Fatalf("%d extra cursors after the relayout, want 2", len(e.ExtraCursors))
+	}
+	for i, index := range []int{5, 60} {
+		extra := e.ExtraCursors[i].Cursor
+		e.SetCursorPositionByIndex(index)
+		if extra.CurrentIndex != index || extra.Rectangle != e.Cursor.Rectangle || extra.Line != e.Cursor.Line {
+			t.Fatalf("extra cursor %d is at %d line %d %v, want line %d %v", i, extra.CurrentIndex, extra.Line, extra.Rectangle, e.Cursor.Line, e.Cursor.Rectangle)
+		}
+	}
+}
+
+// the selection and the pasted text are one edit, laid out once and undone in one step
+func TestPasteOverSelection(t *testing.T) {
+	e := newTestEditor("first paragraph that is long enough to wrap in the editor\nsecond\nthird\n")
+	e.SetSelection(Selection{Anchor: 6, Head: 64})
+	rl.SetClipboardText("pasted\r\ntext that replaces two paragraphs")
+	e.Paste()
+	want := "first pasted\ntext that replaces two paragraphs\nthird\n"
+	if e.PieceTable.ToString() != want {
+		t.Fatalf("the text is %q, want %q", e.PieceTable.ToString(), want)
+	}
+	if e.HasSelection() || e.Cursor.CurrentIndex != 46 {
+		t.Fatalf("the cursor is at %d with the selection %v, want it after the pasted text", e.Cursor.CurrentIndex, e.Selection)
+	}
+	got := linesString(e.Lines)
+	e.CalculateLines()
+	if want := linesString(e.Lines); got != want {
+		t.Fatalf("the lines after the paste are\n%s\nwant\n%s", got, want)
+	}
+	e.Undo()
+	if e.PieceTable.ToString() != "first paragraph that is long enough to wrap in the editor\nsecond\nthird\n" {
+		t.Fatalf("one undo left %q", e.PieceTable.ToString())
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// raylib only bakes into a font's atlas the codepoints it's asked for, so the atlas starts with
+// latin-1 and grows with the codepoints that show up in the text, rebuilding the font each time.
+// The font file is read once and kept in memory for that.
+// A codepoint the font file doesn't have still ends up in the atlas, drawn as the missing glyph,
+// that's why the editor asks Covers first and goes through its fallback fonts.
+// raylib scales a font so its ascender minus its descender is the font size and puts every glyph's
+// baseline at the ascender, so fonts with different ascenders need their runs moved to share a baseline
+
+// @glyph atlas
+const (
+	FIRST_ATLAS_CODEPOINT = 32
+	LAST_ATLAS_CODEPOINT  = 255 // the atlas starts with every codepoint up to here
+)
+
+type GlyphAtlas struct {
+	Font       rl.Font
+	Path       string
+	Size       int
+	fileType   string // the extension with the dot, raylib tells the formats apart by it
+	data       []byte
+	cmap       Cmap
+	metrics    VerticalMetrics
+	codepoints []rune // sorted, every codepoint baked into Font
+}
+
+// Loads the font at path with the latin-1 codepoints
+func NewGlyphAtlas(path string, size int) (*GlyphAtlas, error) {
+	fileType := strings.ToLower(filepath.Ext(path))
+	if fileType != ".ttf" && fileType != ".otf" {
+		return nil, fmt.Errorf("NewGlyphAtlas: %s isn't a .ttf or .otf font", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("NewGlyphAtlas: error trying to read %s: %w", path, err)
+	}
+	cmap, err := ParseCmap(data)
+	if err != nil {
+		return nil, fmt.Errorf("NewGlyphAtlas: error trying to read %s: %w", path, err)
+	}
+	metrics, err := ParseVerticalMetrics(data)
+	if err != nil {
+		return nil, fmt.Errorf("NewGlyphAtlas: error trying to read %s: %w", path, err)
+	}
+	atlas := &GlyphAtlas{
+		Path:     path,
+		Size:     size,
+		fileType: fileType,
+		data:     data,
+		cmap:     cmap,
+		metrics:  metrics,
+	}
+	for cp := rune(FIRST_ATLAS_CODEPOINT); cp <= LAST_ATLAS_CODEPOINT; cp++ {
+		atlas.codepoints = append(atlas.codepoints, cp)
+	}
+	err = atlas.rebuild()
+	if err != nil {
+		return nil, err
+	}
+	return atlas, nil
+}
+
+// whether char is baked into the atlas
+func (g *GlyphAtlas) Has(char rune) bool {
+	_, found := slices.BinarySearch(g.codepoints, char)
+	return found
+}
+
+// whether the font file has a glyph for char
+func (g *GlyphAtlas) Covers(char rune) bool {
+	return g.cmap.GlyphIndex(char) != 0
+}
+
+// how far the glyphs go above and below the baseline when they're drawn at size
+func (g *GlyphAtlas) Extent(size float32) (float32, float32) {
+	scale := size / float32(g.metrics.Ascender-g.metrics.Descender)
+	return float32(g.metrics.Ascender) * scale, float32(-g.metrics.Descender) * scale
+}
+
+// only what can be drawn goes into the atlas, line breaks, tabs and other control chars aren't glyphs
+func isGlyph(char rune) bool {
+	return !unicode.IsControl(char)
+}
+
+// adds the missing chars to the sorted codepoints, returns the ones that were added
+func (g *GlyphAtlas) insertCodepoints(chars []rune) []rune {
+	added := []rune{}
+	for _, char := range chars {
+		if !isGlyph(char) {
+			continue
+		}
+		i, found := slices.BinarySearch(g.codepoints, char)
+		if found {
+			continue
+		}
+		g.codepoints = slices.Insert(g.codepoints, i, char)
+		added = append(added, char)
+	}
+	return added
+}
+
+// Bakes the chars that aren't in the atlas yet, the font is rebuilt once for all of them.
+// Returns the chars added, Font is a new font when there are any
+func (g *GlyphAtlas) Add(chars []rune) ([]rune, error) {
+	added := g.insertCodepoints(chars)
+	if len(added) == 0 {
+		return nil, nil
+	}
+	return added, g.rebuild()
+}
+
+// loads the font again with every codepoint, which uploads a new atlas texture
+func (g *GlyphAtlas) rebuild() error {
+	font := rl.LoadFontFromMemory(g.fileType, g.data, int32(g.Size), g.codepoints)
+	if !rl.IsFontValid(font) {
+		return fmt.Errorf("GlyphAtlas: error trying to load %s", g.Path)
+	}
+	rl.GenTextureMipmaps(&font.Texture)
+	rl.SetTextureFilter(font.Texture, rl.FilterBilinear)
+	g.Unload()
+	g.Font = font
+	return nil
+}
+
+func (g *GlyphAtlas) Unload() {
+	if rl.IsFontValid(g.Font) {
+		rl.UnloadFont(g.Font)
+	}
+	g.Font = rl.Font{}
+}
+
+// where the table with tag starts in the font file
+func fontTable(data []byte, tag string) (int, error) {
+	header := fontBytes(data, 0, 12)
+	if header == nil {
+		return -1, errBadFont
+	}
+	for i := range int(binary.BigEndian.Uint16(header[4:])) {
+		record := fontBytes(data, 12+16*i, 16)
+		if record == nil {
+			return -1, errBadFont
+		}
+		if string(record[:4]) == tag {
+			return int(binary.BigEndian.Uint32(record[8:])), nil
+		}
+	}
+	return -1, fmt.Errorf("the font doesn't have a %s table", tag)
+}
+
+// @vertical metrics
+// The ascender and descender of the hhea table, in font units. The descender is below the baseline, so it's negative
+type VerticalMetrics struct {
+	Ascender, Descender int
+}
+
+func ParseVerticalMetrics(data []byte) (VerticalMetrics, error) {
+	hheaOffset, err := fontTable(data, "hhea")
+	if err != nil {
+		return VerticalMetrics{}, err
+	}
+	hhea := fontBytes(data, hheaOffset, 8)
+	if hhea == nil {
+		return VerticalMetrics{}, errBadFont
+	}
+	metrics := VerticalMetrics{
+		Ascender:  int(int16(binary.BigEndian.Uint16(hhea[4:]))),
+		Descender: int(int16(binary.BigEndian.Uint16(hhea[6:]))),
+	}
+	if metrics.Ascender <= metrics.Descender {
+		return VerticalMetrics{}, errBadFont
+	}
+	return metrics, nil
+}
+
+// @cmap
+// The cmap table of a TrueType/OpenType font maps codepoints to glyph indexes, glyph 0 is the missing glyph.
+// Only the two formats fonts use for unicode are read: 4 for the basic multilingual plane and 12 for all of it
+type Cmap struct {
+	format   uint16
+	subtable []byte
+}
+
+var errBadFont = errors.New("the font's tables are damaged")
+
+// n bytes at offset, nil if they go past the end
+func fontBytes(data []byte, offset int, n int) []byte {
+	if offset < 0 || n < 0 || offset+n > len(data) {
+		return nil
+	}
+	return data[offset : offset+n]
+}
+
+// the first index in [0, n) where key(i) >= char, n if there isn't one
+func searchCodes(n int, char rune, key func(i int) rune) int {
+	low, high := 0, n
+	for low < high {
+		middle := (low + high) / 2
+		if key(middle) < char {
+			low = middle + 1
+		} else {
+			high = middle
+		}
+	}
+	return low
+}
+
+func ParseCmap(data []byte) (Cmap, error) {
+	be := binary.BigEndian
+	cmapOffset, err := fontTable(data, "cmap")
+	if err != nil {
+		return Cmap{}, err
+	}
+	cmapHeader := fontBytes(data, cmapOffset, 4)
+	if cmapHeader == nil {
+		return Cmap{}, errBadFont
+	}
+
+	// format 12 has every codepoint, so it's preferred over format 4
+	best := Cmap{}
+	for i := range int(be.Uint16(cmapHeader[2:])) {
+		record := fontBytes(data, cmapOffset+4+8*i, 8)
+		if record == nil {
+			return Cmap{}, errBadFont
+		}
+		platform, encoding := be.Uint16(record), be.Uint16(record[2:])
+		if platform != 0 && !(platform == 3 && (encoding == 1 || encoding == 10)) {
+			continue
+		}
+		offset := cmapOffset + int(be.Uint32(record[4:]))
+		subtableHeader := fontBytes(data, offset, 8)
+		if subtableHeader == nil {
+			return Cmap{}, errBadFont
+		}
+		format := be.Uint16(subtableHeader)
+		var length int
+		switch format {
+		case 4:
+			length = int(be.Uint16(subtableHeader[2:]))
+		case 12:
+			length = int(be.Uint32(subtableHeader[4:]))
+		default:
+			continue
+		}
+		subtable := fontBytes(data, offset, length)
+		if subtable == nil {
+			return Cmap{}, errBadFont
+		}
+		if format > best.format {
+			best = Cmap{format, subtable}
+		}
+	}
+	if best.format == 0 {
+		return Cmap{}, errors.New("the font doesn't map unicode codepoints")
+	}
+	return best, nil
+}
+
+func (c Cmap) GlyphIndex(char rune) int {
+	be := binary.BigEndian
+	switch c.format {
+	case 4:
+		header := fontBytes(c.subtable, 0, 14)
+		if header == nil || char < 0 || char > 0xffff {
+			return 0
+		}
+		segments := int(be.Uint16(header[6:])) / 2
+		endCodes := 14
+		startCodes := endCodes + 2*segments + 2 // there's a reserved uint16 after the end codes
+		deltas := startCodes + 2*segments
+		rangeOffsets := deltas + 2*segments
+		if fontBytes(c.subtable, rangeOffsets, 2*segments) == nil {
+			return 0
+		}
+		// the segments are sorted by their end code
+		segment := searchCodes(segments, char, func(i int) rune {
+			return rune(be.Uint16(c.subtable[endCodes+2*i:]))
+		})
+		if segment == segments {
+			return 0
+		}
+		start := rune(be.Uint16(c.subtable[startCodes+2*segment:]))
+		if char < start {
+			return 0
+		}
+		delta := be.Uint16(c.subtable[deltas+2*segment:])
+		rangeOffsetPosition := rangeOffsets + 2*segment
+		rangeOffset := int(be.Uint16(c.subtable[rangeOffsetPosition:]))
+		if rangeOffset == 0 {
+			return int(uint16(char) + delta)
+		}
+		// the offset goes from where it's stored to the glyph index
+		glyphBytes := fontBytes(c.subtable, rangeOffsetPosition+rangeOffset+2*int(char-start), 2)
+		if glyphBytes == nil {
+			return 0
+		}
+		glyph := be.Uint16(glyphBytes)
+		if glyph == 0 {
+			return 0
+		}
+		return int(glyph + delta)
+	case 12:
+		header := fontBytes(c.subtable, 0, 16)
+		if header == nil {
+			return 0
+		}
+		groups := int(be.Uint32(header[12:]))
+		if fontBytes(c.subtable, 16, 12*groups) == nil {
+			return 0
+		}
+		// the groups are sorted and each one has its start code, end code and start glyph
+		group := searchCodes(groups, char, func(i int) rune {
+			return rune(be.Uint32(c.subtable[16+12*i+4:]))
+		})
+		if group == groups {
+			return 0
+		}
+		start := rune(be.Uint32(c.subtable[16+12*group:]))
+		if char < start {
+			return 0
+		}
+		return int(be.Uint32(c.subtable[16+12*group+8:])) + int(char-start)
+	}
+	return 0
+}
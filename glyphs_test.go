@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+const TEST_FONT = "fonts/JetBrainsMono-Regular.ttf"
+
+func readTestFont(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(TEST_FONT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// the subtable of format in the font's cmap, ParseCmap only keeps the best one
+func cmapSubtable(t *testing.T, data []byte, format uint16) Cmap {
+	t.Helper()
+	be := binary.BigEndian
+	cmapOffset, err := fontTable(data, "cmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range int(be.Uint16(data[cmapOffset+2:])) {
+		record := data[cmapOffset+4+8*i:]
+		offset := cmapOffset + int(be.Uint32(record[4:]))
+		if be.Uint16(data[offset:]) != format {
+			continue
+		}
+		length := int(be.Uint16(data[offset+2:]))
+		if format == 12 {
+			length = int(be.Uint32(data[offset+4:]))
+		}
+		return Cmap{format, data[offset : offset+length]}
+	}
+	t.Fatalf("%s doesn't have a format %d cmap", TEST_FONT, format)
+	return Cmap{}
+}
+
+func TestParseCmap(t *testing.T) {
+	data := readTestFont(t)
+	cmap, err := ParseCmap(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmap.format != 12 {
+		t.Fatalf("the format %d cmap was picked, want the format 12 one", cmap.format)
+	}
+
+	cmapOffset, err := fontTable(data, "cmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same font with its cmap renamed, so it doesn't have one
+	noCmap := append([]byte{}, data...)
+	for i := range int(binary.BigEndian.Uint16(data[4:])) {
+		if string(noCmap[12+16*i:16+16*i]) == "cmap" {
+			copy(noCmap[12+16*i:], "xxxx")
+		}
+	}
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"no data", nil},
+		{"only the header", data[:12]},
+		{"half the table records", data[:40]},
+		{"the cmap cut before its subtables", data[:cmapOffset+8]},
+		{"the cmap cut inside a subtable", data[:cmapOffset+100]},
+		{"no cmap", noCmap},
+	}
+	for _, c := range cases {
+		if _, err := ParseCmap(c.data); err == nil {
+			t.Errorf("%s: no error", c.name)
+		}
+	}
+}
+
+func TestGlyphIndex(t *testing.T) {
+	data := readTestFont(t)
+	format4 := cmapSubtable(t, data, 4)
+	format12 := cmapSubtable(t, data, 12)
+	cases := []struct {
+		char     rune
+		format4  int
+		format12 int
+	}{
+		{'\r', 960, 960}, // the first group
+		{' ', 958, 958},
+		{'A', 1, 1},
+		{'a', 189, 189},
+		{'0', 724, 724},
+		{'~', 1058, 1058},
+		{'\u007f', 0, 0},
+		{'é', 226, 226},
+		{'ж', 533, 533},
+		{'→', 1139, 1139},
+		{'─', 1326, 1326},
+		{'\ufb01', 0, 0}, // a ligature the font doesn't map
+		{'\uffff', 0, 0},
+		{'\U00016910', 0, 671}, // past the basic multilingual plane only format 12 has it
+		{'\U0001d538', 0, 672},
+		{'\U0001d53a', 0, 0}, // between two groups
+		{'\U0001d56b', 0, 723},
+		{'\U0010ffff', 0, 0},
+		{-1, 0, 0},
+	}
+	for _, c := range cases {
+		if got := format4.GlyphIndex(c.char); got != c.format4 {
+			t.Errorf("format 4: GlyphIndex(%U) is %d, want %d", c.char, got, c.format4)
+		}
+		if got := format12.GlyphIndex(c.char); got != c.format12 {
+			t.Errorf("format 12: GlyphIndex(%U) is %d, want %d", c.char, got, c.format12)
+		}
+	}
+	// both subtables map the basic multilingual plane the same way
+	for char := rune(0); char <= 0xffff; char++ {
+		if format4.GlyphIndex(char) != format12.GlyphIndex(char) {
+			t.Fatalf("GlyphIndex(%U) is %d in format 4 and %d in format 12", char, format4.GlyphIndex(char), format12.GlyphIndex(char))
+		}
+	}
+	// a damaged subtable doesn't map anything instead of reading past its end
+	for _, cmap := range []Cmap{{4, format4.subtable[:20]}, {12, format12.subtable[:30]}} {
+		if got := cmap.GlyphIndex('A'); got != 0 {
+			t.Errorf("a cut format %d subtable gives %d for 'A'", cmap.format, got)
+		}
+	}
+}
@@ -1,14 +1,15 @@
 package main
 
 import (
-	"bufio"
 	"errors"
+	"flag"
 	"fmt"
-	"log"
 	pt "main/piece-table"
 	"main/utils"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
@@ -17,26 +18,57 @@ var keys []int32 = make([]int32, 0)
 
 // @main
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: text-editor [-config file] [-keymap file] [file]")
+		flag.PrintDefaults()
+	}
+	// without a config directory there are just the defaults
+	configPath, _ := ConfigPath("config.json")
+	keymapPath, _ := ConfigPath("keymap.json")
+	flag.StringVar(&configPath, "config", configPath, "JSON file with the editor settings")
+	flag.StringVar(&keymapPath, "keymap", keymapPath, "JSON file binding key chords to commands")
+	flag.Parse()
+	path := flag.Arg(0)
+	original, err := OpenFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "text-editor:", err)
+		os.Exit(1)
+	}
+	original, lineEnding := pt.LoadLineEndings(original)
+
+	config, configErr := LoadConfig(configPath)
+	if configErr != nil {
+		fmt.Fprintln(os.Stderr, "text-editor:", configErr)
+	}
+
 	defer rl.CloseWindow()
-	window := NewWindow(60, 1600, 900)
+	window := NewWindow(config.FPS, config.Width, config.Height)
+	keymap, keymapErr := LoadKeymap(keymapPath, window.Commands)
+	if keymapErr != nil {
+		fmt.Fprintln(os.Stderr, "text-editor:", keymapErr)
+	}
+	window.SetKeymap(keymap)
 	rl.SetTraceLogLevel(rl.LogError)
 	rl.InitWindow(window.Width, window.Height, "Text Editor")
 	rl.SetWindowState(rl.FlagWindowAlwaysRun)
 	rl.SetTargetFPS(window.FPS)
 
-	original, _ := ReadFile("examples/example.txt")
-	// original, _ := ReadFile("output/output 8.txt")
+	// original, _, _ := utils.ReadFile("examples/example.txt")
+	// original, _, _ := utils.ReadFile("output/output 8.txt")
+	// the file's bytes become the OriginalBuffer as they are, without copying,
+	// only a file with CR line breaks gets '\n' ones (see LoadLineEndings)
 	pt := pt.NewPieceTable(
-		pt.Sequence(original),
+		original,
+		pt.WithPieceTree(),
 	)
 	// pt.Insert(20, Sequence("went to the park and\n"))
 	utils.Logger.Println(pt.ToString())
 
-	// original, _ := ReadFile("example2.txt")
-	// original, _ := ReadFile("example3.txt")
+	// original, _, _ := utils.ReadFile("example2.txt")
+	// original, _, _ := utils.ReadFile("example3.txt")
 	// editor := NewEditor(rl.NewRectangle(20, 0, float32(window.Width-100), float32(window.Height-100)), rl.Gray)
 	// editor := NewEditor(rl.NewRectangle(0, 0, 255, float32(window.Height-100)), rl.NewColor(30, 30, 30, 255))
-	editor := NewEditor(rl.NewRectangle(0, 0, float32(window.Width), float32(window.Height)), rl.NewColor(30, 30, 30, 255))
+	editor := NewEditor(rl.NewRectangle(0, 0, float32(window.Width), float32(window.Height)), config.theme)
 	defer func() {
 		if r := recover(); r != nil {
 			OutputText(*editor.PieceTable)
@@ -45,46 +77,54 @@ func main() {
 		}
 	}()
 
-	latin1 := make([]rune, 0, 255-32+1)
-	var cp rune
-	for cp = 32; cp <= 255; cp++ {
-		latin1 = append(latin1, cp)
-	}
-	font := rl.LoadFontEx("fonts/JetBrainsMono-Regular.ttf", int32(editor.FontSize), latin1, int32(len(latin1)))
-	rl.GenTextureMipmaps(&font.Texture)
-	rl.SetTextureFilter(font.Texture, rl.FilterBilinear)
-	defer rl.UnloadFont(font)
-	editor.ChangeFont(&font)
-	// editor.CharSpacing = 3
 	editor.PieceTable = &pt
+	editor.FilePath = path
+	editor.LineEnding = lineEnding
+	editor.savedLineEnding = lineEnding
 	window.Editor = &editor
-	window.Editor.CalculateLines()
+	window.configWatcher = NewConfigWatcher(configPath)
+	fontErr := window.ApplyConfig(config)
+	if fontErr != nil {
+		fmt.Fprintln(os.Stderr, "text-editor:", fontErr)
+	}
+	defer window.UnloadFonts()
+	window.UpdateTitle()
+	if keymapErr != nil {
+		window.ShowMessage("keymap: some bindings have errors, see the terminal")
+	}
+	if configErr != nil || fontErr != nil {
+		window.ShowMessage("config: some settings have errors, see the terminal")
+	}
 
 	for !rl.WindowShouldClose() {
 		rl.ClearBackground(rl.White)
+		window.ReloadConfig()
 		window.Input()
+		window.UpdateTitle()
 		rl.BeginDrawing()
 		window.Draw()
 		rl.EndDrawing()
 	}
 }
 
-func ReadFile(path string) (string, int) {
-	file, err := os.Open(path)
+// A path that doesn't exist yet opens an empty text, the file is created when it's saved.
+// No path at all is an empty text too, without a file
+func OpenFile(path string) (pt.Sequence, error) {
+	if path == "" {
+		return pt.Sequence{}, nil
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pt.Sequence{}, nil
+	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	str := ""
-	i := 0
-	for scanner.Scan() {
-		fmt.Println(scanner.Text())
-		str += scanner.Text() + "\n"
-		i++
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
 	}
-	return str, i
+	original, _, err := utils.ReadFile(path)
+	return pt.Sequence(original), err
 }
 
 // @window
@@ -96,25 +136,245 @@ type Window struct {
 	FPS           int32
 	Width, Height int32
 	Editor        *Editor
+	Prompt        *Prompt // while it's open it gets all the keyboard input
+	Message       string  // shown at the bottom for a few seconds, like save errors
+	messageTime   float64
+	title         string
+	KeyRepeat     KeyRepeat
+	Commands      Commands
+	Keymap        Keymap
+	keymapKeys    []int32 // the keys the keymap uses, set by SetKeymap
+	Config        Config  // the settings applied last, see ApplyConfig
+	configWatcher ConfigWatcher
+	glyphs        *GlyphAtlas // the editor's fonts, see LoadFonts
+	fallbacks     []*GlyphAtlas
 	// Events        []Event
 }
 
 func NewWindow(FPS int32, Width int32, Height int32) Window {
 	return Window{
-		FPS,
-		Width,
-		Height,
-		&Editor{},
+		FPS:       FPS,
+		Width:     Width,
+		Height:    Height,
+		Editor:    &Editor{},
+		KeyRepeat: NewKeyRepeat(KEY_REPEAT_DELAY, KEY_REPEAT_RATE),
+		Commands:  NewCommands(),
 	}
 }
 
+// @key repeat
+// rl.IsKeyPressed is only true on the frame a key goes down, so holding a key would act only once.
+// The chars from rl.GetCharPressed already repeat, the system does it
+
+const (
+	KEY_REPEAT_DELAY = 0.4  // seconds a key is held before it starts repeating
+	KEY_REPEAT_RATE  = 30.0 // repeats per second after the delay
+)
+
+type KeyRepeat struct {
+	Delay float32
+	Rate  float32
+	held  map[int32]float32 // seconds each key has been held down
+}
+
+func NewKeyRepeat(delay float32, rate float32) KeyRepeat {
+	return KeyRepeat{
+		Delay: delay,
+		Rate:  rate,
+		held:  make(map[int32]float32),
+	}
+}
+
+// True on the frame key is pressed and, while it's held, once every 1/Rate seconds after Delay.
+// It must be called once per frame for each key, every call counts the frame time
+func (k *KeyRepeat) IsKeyPressed(key int32) bool {
+	if rl.IsKeyPressed(key) {
+		k.held[key] = 0
+		return true
+	}
+	previous, ok := k.held[key]
+	if !ok {
+		return false
+	}
+	if !rl.IsKeyDown(key) {
+		delete(k.held, key)
+		return false
+	}
+	held := previous + rl.GetFrameTime()
+	k.held[key] = held
+	if held < k.Delay || k.Rate <= 0 {
+		return false
+	}
+	if previous < k.Delay {
+		return true
+	}
+	// a slow frame can go past many repeats, they become a single one
+	interval := 1 / k.Rate
+	return int((held-k.Delay)/interval) > int((previous-k.Delay)/interval)
+}
+
+// seconds a message stays on the screen
+const MESSAGE_TIME = 3.0
+
+func (w *Window) ShowMessage(message string) {
+	w.Message = message
+	w.messageTime = rl.GetTime()
+}
+
+// the title only changes when the file or its dirty state changes, so it's cheap to call every frame
+func (w *Window) UpdateTitle() {
+	name := "untitled"
+	if w.Editor.FilePath != "" {
+		name = filepath.Base(w.Editor.FilePath)
+	}
+	if w.Editor.IsDirty() {
+		name = "*" + name
+	}
+	title := name + " - Text Editor"
+	if title != w.title {
+		w.title = title
+		rl.SetWindowTitle(title)
+	}
+}
+
+// @file
+
+func (w *Window) Save() {
+	if w.Editor.FilePath == "" {
+		w.SaveAs()
+		return
+	}
+	err := w.Editor.Save()
+	if err != nil {
+		w.ShowMessage(err.Error())
+		return
+	}
+	w.ShowMessage("Saved " + w.Editor.FilePath)
+}
+
+func (w *Window) SaveAs() {
+	w.OpenPrompt("Save as: ", w.Editor.FilePath, func(path string) {
+		if path == "" {
+			return
+		}
+		err := w.Editor.SaveAs(path)
+		if err != nil {
+			w.ShowMessage(err.Error())
+			return
+		}
+		w.ShowMessage("Saved " + path)
+	})
+}
+
+// asks for the line ending every line break of the text is converted to
+func (w *Window) ChangeLineEnding() {
+	current := pt.LINE_ENDING_NAMES[w.Editor.LineEnding]
+	w.OpenPrompt("Line endings (LF, CRLF, CR): ", current, func(name string) {
+		for ending, endingName := range pt.LINE_ENDING_NAMES {
+			if strings.EqualFold(name, endingName) {
+				w.Editor.SetLineEnding(ending)
+				w.ShowMessage("Line endings: " + endingName)
+				return
+			}
+		}
+		w.ShowMessage("Unknown line ending: " + name)
+	})
+}
+
+// switches the theme until the config changes, the config's theme is the one used at startup
+func (w *Window) ChangeTheme() {
+	dir := ThemesDir()
+	label := "Theme (" + strings.Join(ThemeNames(dir), ", ") + "): "
+	w.OpenPrompt(label, w.Editor.Theme.Name, func(name string) {
+		theme, err := FindTheme(name, dir)
+		if theme.Name == "" {
+			w.ShowMessage(err.Error())
+			return
+		}
+		w.Editor.SetTheme(theme)
+		if err != nil {
+			w.ShowMessage(err.Error())
+			return
+		}
+		w.ShowMessage("Theme: " + theme.Name)
+	})
+}
+
+// @prompt
+type Prompt struct {
+	Label    string
+	Text     []rune
+	OnSubmit func(text string)
+}
+
+func (w *Window) OpenPrompt(label string, text string, onSubmit func(text string)) {
+	w.Prompt = &Prompt{Label: label, Text: []rune(text), OnSubmit: onSubmit}
+	// escape closes the prompt instead of the window
+	rl.SetExitKey(rl.KeyNull)
+}
+
+func (w *Window) ClosePrompt() {
+	w.Prompt = nil
+	rl.SetExitKey(rl.KeyEscape)
+}
+
+func (w *Window) PromptInput() {
+	prompt := w.Prompt
+	for char := rl.GetCharPressed(); char != 0; char = rl.GetCharPressed() {
+		prompt.Text = append(prompt.Text, char)
+		// the prompt is drawn with the editor's font
+		w.Editor.AddGlyphs(pt.Sequence(string(char)))
+	}
+	if w.KeyRepeat.IsKeyPressed(rl.KeyBackspace) && len(prompt.Text) > 0 {
+		prompt.Text = prompt.Text[:len(prompt.Text)-1]
+	}
+	if rl.IsKeyPressed(rl.KeyEscape) {
+		w.ClosePrompt()
+		return
+	}
+	if rl.IsKeyPressed(rl.KeyEnter) || rl.IsKeyPressed(rl.KeyKpEnter) {
+		// closed before submitting so OnSubmit can open another prompt
+		w.ClosePrompt()
+		prompt.OnSubmit(strings.TrimSpace(string(prompt.Text)))
+	}
+}
+
+func (w *Window) DrawPrompt() {
+	ascent, descent := w.Editor.CharExtent('\n')
+	height := ascent + descent + 10
+	rectangle := rl.NewRectangle(0, float32(w.Height)-height, float32(w.Width), height)
+	rl.DrawRectangleRec(rectangle, rl.Color(w.Editor.Theme.Panel))
+	text := w.Prompt.Label + string(w.Prompt.Text)
+	position := rl.NewVector2(rectangle.X+10, rectangle.Y+5)
+	w.Editor.DrawRunes(text, rl.NewVector2(position.X, position.Y+ascent), 0, rl.Color(w.Editor.Theme.PanelText))
+	textWidth := w.Editor.SequenceRectangle(pt.Sequence(text)).X
+	rl.DrawRectangle(int32(position.X+textWidth), int32(position.Y), 2, int32(ascent+descent), w.Editor.Cursor.Color)
+}
+
+func (w *Window) DrawMessage() {
+	if w.Message == "" || rl.GetTime()-w.messageTime > MESSAGE_TIME {
+		return
+	}
+	fontSize := int32(20)
+	width := rl.MeasureText(w.Message, fontSize)
+	x := w.Width - width - 20
+	y := w.Height - fontSize - 15
+	rl.DrawRectangle(x-10, y-5, width+20, fontSize+10, rl.Color(w.Editor.Theme.Panel))
+	rl.DrawText(w.Message, x, y, fontSize, rl.Color(w.Editor.Theme.PanelText))
+}
+
 func (w *Window) Draw() {
 	w.Editor.Draw()
+	defer w.DrawMessage()
+	if w.Prompt != nil {
+		defer w.DrawPrompt()
+	}
 	mouse := rl.GetMousePosition()
 	mouseStr := fmt.Sprintf("Mouse X: %f Mouse Y: %f", mouse.X, mouse.Y)
 	currentLine := w.Editor.Lines[w.Editor.Cursor.Line]
-	rl.DrawText(mouseStr, w.Width/2, w.Height/2, 20, rl.Pink)
-	rl.DrawText("Current position: "+strconv.Itoa(w.Editor.Cursor.CurrentIndex), w.Width/2, w.Height/2+30, 20, rl.Pink)
+	debugColor := rl.Color(w.Editor.Theme.Debug)
+	rl.DrawText(mouseStr, w.Width/2, w.Height/2, 20, debugColor)
+	rl.DrawText("Current position: "+strconv.Itoa(w.Editor.Cursor.CurrentIndex), w.Width/2, w.Height/2+30, 20, debugColor)
 	rl.DrawText(
 		"Line: "+strconv.Itoa(w.Editor.Cursor.Line)+
 			" | Start: "+strconv.Itoa(w.Editor.Lines[w.Editor.Cursor.Line].Start)+
@@ -123,33 +383,37 @@ func (w *Window) Draw() {
 		w.Width/2,
 		w.Height/2+60,
 		20,
-		rl.Pink,
+		debugColor,
 	)
 	lineWidth := currentLine.Rectangle.Width
-	rl.DrawText("Line Width: "+strconv.Itoa(int(lineWidth)), w.Width/2, w.Height/2+90, 20, rl.Pink)
-	rl.DrawText("Column: "+strconv.Itoa(w.Editor.Cursor.Column), w.Width/2, w.Height/2+120, 20, rl.Pink)
+	rl.DrawText("Line Width: "+strconv.Itoa(int(lineWidth)), w.Width/2, w.Height/2+90, 20, debugColor)
+	rl.DrawText("Column: "+strconv.Itoa(w.Editor.Cursor.Column), w.Width/2, w.Height/2+120, 20, debugColor)
 
 	char, _ := w.Editor.PieceTable.GetAt(uint(w.Editor.Cursor.CurrentIndex))
-	rl.DrawText("Current character: "+string(char), w.Width/2, w.Height/2+150, 20, rl.Pink)
-	rl.DrawText("Previous character: "+string(w.Editor.PreviousCharacter), w.Width/2, w.Height/2+180, 20, rl.Pink)
+	rl.DrawText("Current character: "+string(char), w.Width/2, w.Height/2+150, 20, debugColor)
+	rl.DrawText("Previous character: "+string(w.Editor.PreviousCharacter), w.Width/2, w.Height/2+180, 20, debugColor)
 
-	rl.DrawText("Cursor X: "+strconv.FormatFloat(float64(w.Editor.Cursor.Rectangle.X), 'f', 2, 32), w.Width/2, w.Height/2+210, 20, rl.Pink)
-	rl.DrawText("Cursor Y: "+strconv.FormatFloat(float64(w.Editor.Cursor.Rectangle.Y), 'f', 2, 32), w.Width/2, w.Height/2+240, 20, rl.Pink)
-	rl.DrawText("FPS: "+strconv.Itoa(int(rl.GetFPS())), w.Width/2, w.Height/2+270, 20, rl.Pink)
+	rl.DrawText("Cursor X: "+strconv.FormatFloat(float64(w.Editor.Cursor.Rectangle.X), 'f', 2, 32), w.Width/2, w.Height/2+210, 20, debugColor)
+	rl.DrawText("Cursor Y: "+strconv.FormatFloat(float64(w.Editor.Cursor.Rectangle.Y), 'f', 2, 32), w.Width/2, w.Height/2+240, 20, debugColor)
+	rl.DrawText("FPS: "+strconv.Itoa(int(rl.GetFPS())), w.Width/2, w.Height/2+270, 20, debugColor)
 
-	rl.DrawText("Editor.EditorRec.X: "+strconv.Itoa(int(w.Editor.EditorRec.X)), w.Width/2, w.Height/2+300, 20, rl.Pink)
-	rl.DrawText("Editor.WritableRec.X: "+strconv.Itoa(int(w.Editor.WritableRec.X)), w.Width/2, w.Height/2+330, 20, rl.Pink)
+	rl.DrawText("Editor.EditorRec.X: "+strconv.Itoa(int(w.Editor.EditorRec.X)), w.Width/2, w.Height/2+300, 20, debugColor)
+	rl.DrawText("Editor.WritableRec.X: "+strconv.Itoa(int(w.Editor.WritableRec.X)), w.Width/2, w.Height/2+330, 20, debugColor)
 
 	rl.DrawRectangle(
 		int32(w.Editor.WritableRec.X+lineWidth),
-		currentLine.Rectangle.ToInt32().Y,
+		int32(currentLine.Rectangle.Y-w.Editor.ScrollY),
 		w.Editor.Cursor.Rectangle.ToInt32().Width,
 		w.Editor.Cursor.Rectangle.ToInt32().Height,
-		rl.NewColor(rl.Pink.R, rl.Pink.G, rl.Pink.B, 128),
+		rl.NewColor(debugColor.R, debugColor.G, debugColor.B, 128),
 	)
 }
 
 func (w *Window) Input() {
+	if w.Prompt != nil {
+		w.PromptInput()
+		return
+	}
 	// if w.Editor.InFocus {
 	if true { // this should be on editor struct like editor.update()
 		char := rl.GetCharPressed()
@@ -157,33 +421,14 @@ func (w *Window) Input() {
 			fmt.Println(char, "string:", string(char), w.Editor.CharRectangle(char))
 		}
 
-		// @arrows input
-		if rl.IsKeyPressed(rl.KeyRight) {
-			w.Editor.MoveCursorForward()
-		}
-		if rl.IsKeyPressed(rl.KeyLeft) {
-			w.Editor.MoveCursorBackward()
-		}
-		if rl.IsKeyPressed(rl.KeyUp) {
-			w.Editor.MoveCursorUpward()
-		}
-		if rl.IsKeyPressed(rl.KeyDown) {
-			w.Editor.MoveCursorDownward()
-		}
+		// every other key goes through the keymap, see commands.go
+		w.RunKeymap()
 
-		if rl.IsKeyPressed(rl.KeyApostrophe) {
-			OutputText(*w.Editor.PieceTable)
-			OutputKeys()
-			os.Exit(1)
-		}
-
-		if rl.IsKeyPressed(rl.KeyBackspace) {
-			w.Editor.Delete(w.Editor.Cursor.CurrentIndex, 1)
-		}
-
-		if char != 0 {
+		// some platforms still send chars while control is held, but AltGr comes as Ctrl+Alt
+		// on windows and the chars typed with it (like @ or { on many layouts) must go through
+		if char != 0 && (!IsControlDown() || IsAltDown()) {
 			keys = append(keys, char)
-			w.Editor.Insert(w.Editor.Cursor.CurrentIndex, pt.Sequence([]byte(string(char))))
+			w.Editor.Type(pt.Sequence([]byte(string(char))))
 			// w.Editor.PieceTable.Insert(uint(w.Editor.Cursor.CurrentIndex), []rune{char})
 			// w.Editor.MoveCursorForward()
 			// w.Editor.CalculateLines()
@@ -191,12 +436,33 @@ func (w *Window) Input() {
 	}
 
 	// @mouse input
-	if rl.IsMouseButtonPressed(rl.MouseButtonLeft) {
-		err := w.Editor.SetCursorPositionByClick(rl.GetMousePosition())
+	wheel := rl.GetMouseWheelMove()
+	if wheel != 0 {
+		w.Editor.ScrollBy(-wheel * w.Editor.ScrollSpeed)
+	}
+	if rl.IsMouseButtonPressed(rl.MouseButtonLeft) && !w.Editor.StartScrollbarDrag(rl.GetMousePosition()) {
+		var err error
+		if IsControlDown() {
+			err = w.Editor.AddCursorAtClick(rl.GetMousePosition())
+		} else {
+			// shift+click extends the selection up to the click
+			err = w.Editor.StartSelectionDrag(rl.GetMousePosition(), IsShiftDown())
+		}
+		if err != nil {
+			w.ShowMessage("Mouse click: " + err.Error())
+		}
+	}
+	if rl.IsMouseButtonDown(rl.MouseButtonLeft) {
+		w.Editor.DragScrollbar(rl.GetMousePosition())
+		err := w.Editor.DragSelection(rl.GetMousePosition())
 		if err != nil {
-			log.Fatal("Mouse right click: ", err)
+			w.ShowMessage("Mouse drag: " + err.Error())
 		}
 	}
+	if rl.IsMouseButtonReleased(rl.MouseButtonLeft) {
+		w.Editor.StopScrollbarDrag()
+		w.Editor.StopSelectionDrag()
+	}
 	if rl.IsMouseButtonPressed(rl.MouseRightButton) {
 		// ------------ Debugging ------------
 
@@ -214,6 +480,18 @@ func (w *Window) Input() {
 	}
 }
 
+func IsControlDown() bool {
+	return rl.IsKeyDown(rl.KeyLeftControl) || rl.IsKeyDown(rl.KeyRightControl)
+}
+
+func IsShiftDown() bool {
+	return rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift)
+}
+
+func IsAltDown() bool {
+	return rl.IsKeyDown(rl.KeyLeftAlt) || rl.IsKeyDown(rl.KeyRightAlt)
+}
+
 func OutputText(pt pt.PieceTable) {
 	n := 1
 	for {
@@ -0,0 +1,849 @@
+package piecetable
+
+import (
+	"slices"
+	"sort"
+	"unicode"
+)
+
+// The unicode bidirectional algorithm (UAX #9) finds the order right to left text, like arabic
+// and hebrew, is drawn in. The text is always kept in logical order, the order it's typed and read in,
+// only the drawing is in visual order: BidiLevels resolves the embedding level of every rune of
+// a paragraph and BidiVisualOrder reorders a line by those levels, where odd levels are right to left.
+// The classes are the ones of unicode 15.
+
+type BidiClass = int
+
+const (
+	BIDI_L   BidiClass = iota // left to right
+	BIDI_R                    // right to left
+	BIDI_AL                   // arabic letter
+	BIDI_EN                   // european number
+	BIDI_ES                   // european separator
+	BIDI_ET                   // european terminator
+	BIDI_AN                   // arabic number
+	BIDI_CS                   // common separator
+	BIDI_NSM                  // nonspacing mark
+	BIDI_BN                   // boundary neutral
+	BIDI_B                    // paragraph separator
+	BIDI_S                    // segment separator
+	BIDI_WS                   // whitespace
+	BIDI_ON                   // other neutral
+	BIDI_LRE                  // the explicit formatting chars, from here on
+	BIDI_LRO
+	BIDI_RLE
+	BIDI_RLO
+	BIDI_PDF
+	BIDI_LRI
+	BIDI_RLI
+	BIDI_FSI
+	BIDI_PDI
+)
+
+// the deepest embedding level
+const MAX_BIDI_DEPTH = 125
+
+type bidiRange struct {
+	First, Last rune
+	Class       BidiClass
+}
+
+// Every range with a class other than L, sorted. Nonspacing and enclosing marks aren't here,
+// they're NSM unless a range says otherwise
+var BIDI_RANGES = []bidiRange{
+	{0x0000, 0x0008, BIDI_BN}, {0x0009, 0x0009, BIDI_S}, {0x000a, 0x000a, BIDI_B}, {0x000b, 0x000b, BIDI_S},
+	{0x000c, 0x000c, BIDI_WS}, {0x000d, 0x000d, BIDI_B}, {0x000e, 0x001b, BIDI_BN}, {0x001c, 0x001e, BIDI_B},
+	{0x001f, 0x001f, BIDI_S}, {0x0020, 0x0020, BIDI_WS}, {0x0021, 0x0022, BIDI_ON}, {0x0023, 0x0025, BIDI_ET},
+	{0x0026, 0x002a, BIDI_ON}, {0x002b, 0x002b, BIDI_ES}, {0x002c, 0x002c, BIDI_CS}, {0x002d, 0x002d, BIDI_ES},
+	{0x002e, 0x002f, BIDI_CS}, {0x0030, 0x0039, BIDI_EN}, {0x003a, 0x003a, BIDI_CS}, {0x003b, 0x0040, BIDI_ON},
+	{0x005b, 0x0060, BIDI_ON}, {0x007b, 0x007e, BIDI_ON}, {0x007f, 0x0084, BIDI_BN}, {0x0085, 0x0085, BIDI_B},
+	{0x0086, 0x009f, BIDI_BN}, {0x00a0, 0x00a0, BIDI_CS}, {0x00a1, 0x00a1, BIDI_ON}, {0x00a2, 0x00a5, BIDI_ET},
+	{0x00a6, 0x00a9, BIDI_ON}, {0x00ab, 0x00ac, BIDI_ON}, {0x00ad, 0x00ad, BIDI_BN}, {0x00ae, 0x00af, BIDI_ON},
+	{0x00b0, 0x00b1, BIDI_ET}, {0x00b2, 0x00b3, BIDI_EN}, {0x00b4, 0x00b4, BIDI_ON}, {0x00b6, 0x00b8, BIDI_ON},
+	{0x00b9, 0x00b9, BIDI_EN}, {0x00bb, 0x00bf, BIDI_ON}, {0x00d7, 0x00d7, BIDI_ON}, {0x00f7, 0x00f7, BIDI_ON},
+	{0x02b9, 0x02ba, BIDI_ON}, {0x02c2, 0x02cf, BIDI_ON}, {0x02d2, 0x02df, BIDI_ON}, {0x02e5, 0x02ed, BIDI_ON},
+	{0x02ef, 0x02ff, BIDI_ON}, {0x0374, 0x0375, BIDI_ON}, {0x037e, 0x037e, BIDI_ON}, {0x0384, 0x0385, BIDI_ON},
+	{0x0387, 0x0387, BIDI_ON}, {0x03f6, 0x03f6, BIDI_ON}, {0x058a, 0x058a, BIDI_ON}, {0x058d, 0x058e, BIDI_ON},
+	{0x058f, 0x058f, BIDI_ET}, {0x0590, 0x0590, BIDI_R}, {0x05be, 0x05be, BIDI_R}, {0x05c0, 0x05c0, BIDI_R},
+	{0x05c3, 0x05c3, BIDI_R}, {0x05c6, 0x05c6, BIDI_R}, {0x05c8, 0x05ff, BIDI_R}, {0x0600, 0x0605, BIDI_AN},
+	{0x0606, 0x0607, BIDI_ON}, {0x0608, 0x0608, BIDI_AL}, {0x0609, 0x060a, BIDI_ET}, {0x060b, 0x060b, BIDI_AL},
+	{0x060c, 0x060c, BIDI_CS}, {0x060d, 0x060d, BIDI_AL}, {0x060e, 0x060f, BIDI_ON}, {0x061b, 0x064a, BIDI_AL},
+	{0x0660, 0x0669, BIDI_AN}, {0x066a, 0x066a, BIDI_ET}, {0x066b, 0x066c, BIDI_AN}, {0x066d, 0x066f, BIDI_AL},
+	{0x0671, 0x06d5, BIDI_AL}, {0x06dd, 0x06dd, BIDI_AN}, {0x06de, 0x06de, BIDI_ON}, {0x06e5, 0x06e6, BIDI_AL},
+	{0x06e9, 0x06e9, BIDI_ON}, {0x06ee, 0x06ef, BIDI_AL}, {0x06f0, 0x06f9, BIDI_EN}, {0x06fa, 0x0710, BIDI_AL},
+	{0x0712, 0x072f, BIDI_AL}, {0x074b, 0x07a5, BIDI_AL}, {0x07b1, 0x07bf, BIDI_AL}, {0x07c0, 0x07ea, BIDI_R},
+	{0x07f4, 0x07f5, BIDI_R}, {0x07f6, 0x07f9, BIDI_ON}, {0x07fa, 0x07fc, BIDI_R}, {0x07fe, 0x0815, BIDI_R},
+	{0x081a, 0x081a, BIDI_R}, {0x0824, 0x0824, BIDI_R}, {0x0828, 0x0828, BIDI_R}, {0x082e, 0x0858, BIDI_R},
+	{0x085c, 0x085f, BIDI_R}, {0x0860, 0x086a, BIDI_AL}, {0x086b, 0x086f, BIDI_R}, {0x0870, 0x088e, BIDI_AL},
+	{0x088f, 0x088f, BIDI_R}, {0x0890, 0x0891, BIDI_AN}, {0x0892, 0x0897, BIDI_R}, {0x08a0, 0x08c9, BIDI_AL},
+	{0x08e2, 0x08e2, BIDI_AN}, {0x09f2, 0x09f3, BIDI_ET}, {0x09fb, 0x09fb, BIDI_ET}, {0x0af1, 0x0af1, BIDI_ET},
+	{0x0bf3, 0x0bf8, BIDI_ON}, {0x0bf9, 0x0bf9, BIDI_ET}, {0x0bfa, 0x0bfa, BIDI_ON}, {0x0c78, 0x0c7e, BIDI_ON},
+	{0x0cbf, 0x0cbf, BIDI_L}, {0x0cc6, 0x0cc6, BIDI_L}, {0x0e3f, 0x0e3f, BIDI_ET}, {0x0f3a, 0x0f3d, BIDI_ON},
+	{0x1390, 0x1399, BIDI_ON}, {0x1400, 0x1400, BIDI_ON}, {0x1680, 0x1680, BIDI_WS}, {0x169b, 0x169c, BIDI_ON},
+	{0x17db, 0x17db, BIDI_ET}, {0x17f0, 0x17f9, BIDI_ON}, {0x1800, 0x180a, BIDI_ON}, {0x180e, 0x180e, BIDI_BN},
+	{0x1940, 0x1940, BIDI_ON}, {0x1944, 0x1945, BIDI_ON}, {0x19de, 0x19ff, BIDI_ON}, {0x1acf, 0x1add, BIDI_L},
+	{0x1ae0, 0x1aeb, BIDI_L}, {0x1fbd, 0x1fbd, BIDI_ON}, {0x1fbf, 0x1fc1, BIDI_ON}, {0x1fcd, 0x1fcf, BIDI_ON},
+	{0x1fdd, 0x1fdf, BIDI_ON}, {0x1fed, 0x1fef, BIDI_ON}, {0x1ffd, 0x1ffe, BIDI_ON}, {0x2000, 0x200a, BIDI_WS},
+	{0x200b, 0x200d, BIDI_BN}, {0x200f, 0x200f, BIDI_R}, {0x2010, 0x2027, BIDI_ON}, {0x2028, 0x2028, BIDI_WS},
+	{0x2029, 0x2029, BIDI_B}, {0x202a, 0x202a, BIDI_LRE}, {0x202b, 0x202b, BIDI_RLE}, {0x202c, 0x202c, BIDI_PDF},
+	{0x202d, 0x202d, BIDI_LRO}, {0x202e, 0x202e, BIDI_RLO}, {0x202f, 0x202f, BIDI_CS}, {0x2030, 0x2034, BIDI_ET},
+	{0x2035, 0x2043, BIDI_ON}, {0x2044, 0x2044, BIDI_CS}, {0x2045, 0x205e, BIDI_ON}, {0x205f, 0x205f, BIDI_WS},
+	{0x2060, 0x2065, BIDI_BN}, {0x2066, 0x2066, BIDI_LRI}, {0x2067, 0x2067, BIDI_RLI}, {0x2068, 0x2068, BIDI_FSI},
+	{0x2069, 0x2069, BIDI_PDI}, {0x206a, 0x206f, BIDI_BN}, {0x2070, 0x2070, BIDI_EN}, {0x2074, 0x2079, BIDI_EN},
+	{0x207a, 0x207b, BIDI_ES}, {0x207c, 0x207e, BIDI_ON}, {0x2080, 0x2089, BIDI_EN}, {0x208a, 0x208b, BIDI_ES},
+	{0x208c, 0x208e, BIDI_ON}, {0x20a0, 0x20cf, BIDI_ET}, {0x2100, 0x2101, BIDI_ON}, {0x2103, 0x2106, BIDI_ON},
+	{0x2108, 0x2109, BIDI_ON}, {0x2114, 0x2114, BIDI_ON}, {0x2116, 0x2118, BIDI_ON}, {0x211e, 0x2123, BIDI_ON},
+	{0x2125, 0x2125, BIDI_ON}, {0x2127, 0x2127, BIDI_ON}, {0x2129, 0x2129, BIDI_ON}, {0x212e, 0x212e, BIDI_ET},
+	{0x213a, 0x213b, BIDI_ON}, {0x2140, 0x2144, BIDI_ON}, {0x214a, 0x214d, BIDI_ON}, {0x2150, 0x215f, BIDI_ON},
+	{0x2189, 0x218b, BIDI_ON}, {0x2190, 0x2211, BIDI_ON}, {0x2212, 0x2212, BIDI_ES}, {0x2213, 0x2213, BIDI_ET},
+	{0x2214, 0x2335, BIDI_ON}, {0x237b, 0x2394, BIDI_ON}, {0x2396, 0x2426, BIDI_ON}, {0x2440, 0x244a, BIDI_ON},
+	{0x2460, 0x2487, BIDI_ON}, {0x2488, 0x249b, BIDI_EN}, {0x24ea, 0x26ab, BIDI_ON}, {0x26ad, 0x27ff, BIDI_ON},
+	{0x2900, 0x2b73, BIDI_ON}, {0x2b76, 0x2b95, BIDI_ON}, {0x2b97, 0x2bff, BIDI_ON}, {0x2ce5, 0x2cea, BIDI_ON},
+	{0x2cf9, 0x2cff, BIDI_ON}, {0x2e00, 0x2e5d, BIDI_ON}, {0x2e80, 0x2e99, BIDI_ON}, {0x2e9b, 0x2ef3, BIDI_ON},
+	{0x2f00, 0x2fd5, BIDI_ON}, {0x2ff0, 0x2ffb, BIDI_ON}, {0x3000, 0x3000, BIDI_WS}, {0x3001, 0x3004, BIDI_ON},
+	{0x3008, 0x3020, BIDI_ON}, {0x3030, 0x3030, BIDI_ON}, {0x3036, 0x3037, BIDI_ON}, {0x303d, 0x303f, BIDI_ON},
+	{0x309b, 0x309c, BIDI_ON}, {0x30a0, 0x30a0, BIDI_ON}, {0x30fb, 0x30fb, BIDI_ON}, {0x31c0, 0x31e3, BIDI_ON},
+	{0x321d, 0x321e, BIDI_ON}, {0x3250, 0x325f, BIDI_ON}, {0x327c, 0x327e, BIDI_ON}, {0x32b1, 0x32bf, BIDI_ON},
+	{0x32cc, 0x32cf, BIDI_ON}, {0x3377, 0x337a, BIDI_ON}, {0x33de, 0x33df, BIDI_ON}, {0x33ff, 0x33ff, BIDI_ON},
+	{0x4dc0, 0x4dff, BIDI_ON}, {0xa490, 0xa4c6, BIDI_ON}, {0xa60d, 0xa60f, BIDI_ON}, {0xa673, 0xa673, BIDI_ON},
+	{0xa67e, 0xa67f, BIDI_ON}, {0xa700, 0xa721, BIDI_ON}, {0xa788, 0xa788, BIDI_ON}, {0xa828, 0xa82b, BIDI_ON},
+	{0xa838, 0xa839, BIDI_ET}, {0xa874, 0xa877, BIDI_ON}, {0xab6a, 0xab6b, BIDI_ON}, {0xd800, 0xdfff, BIDI_ON},
+	{0xfb1d, 0xfb1d, BIDI_R}, {0xfb1f, 0xfb28, BIDI_R}, {0xfb29, 0xfb29, BIDI_ES}, {0xfb2a, 0xfb4f, BIDI_R},
+	{0xfb50, 0xfd3d, BIDI_AL}, {0xfd3e, 0xfd4f, BIDI_ON}, {0xfd50, 0xfdce, BIDI_AL}, {0xfdcf, 0xfdcf, BIDI_ON},
+	{0xfdd0, 0xfdef, BIDI_BN}, {0xfdf0, 0xfdfc, BIDI_AL}, {0xfdfd, 0xfdff, BIDI_ON}, {0xfe10, 0xfe19, BIDI_ON},
+	{0xfe30, 0xfe4f, BIDI_ON}, {0xfe50, 0xfe50, BIDI_CS}, {0xfe51, 0xfe51, BIDI_ON}, {0xfe52, 0xfe52, BIDI_CS},
+	{0xfe54, 0xfe54, BIDI_ON}, {0xfe55, 0xfe55, BIDI_CS}, {0xfe56, 0xfe5e, BIDI_ON}, {0xfe5f, 0xfe5f, BIDI_ET},
+	{0xfe60, 0xfe61, BIDI_ON}, {0xfe62, 0xfe63, BIDI_ES}, {0xfe64, 0xfe66, BIDI_ON}, {0xfe68, 0xfe68, BIDI_ON},
+	{0xfe69, 0xfe6a, BIDI_ET}, {0xfe6b, 0xfe6b, BIDI_ON}, {0xfe70, 0xfefe, BIDI_AL}, {0xfeff, 0xfeff, BIDI_BN},
+	{0xff01, 0xff02, BIDI_ON}, {0xff03, 0xff05, BIDI_ET}, {0xff06, 0xff0a, BIDI_ON}, {0xff0b, 0xff0b, BIDI_ES},
+	{0xff0c, 0xff0c, BIDI_CS}, {0xff0d, 0xff0d, BIDI_ES}, {0xff0e, 0xff0f, BIDI_CS}, {0xff10, 0xff19, BIDI_EN},
+	{0xff1a, 0xff1a, BIDI_CS}, {0xff1b, 0xff20, BIDI_ON}, {0xff3b, 0xff40, BIDI_ON}, {0xff5b, 0xff65, BIDI_ON},
+	{0xffe0, 0xffe1, BIDI_ET}, {0xffe2, 0xffe4, BIDI_ON}, {0xffe5, 0xffe6, BIDI_ET}, {0xffe8, 0xffee, BIDI_ON},
+	{0xfff0, 0xfff8, BIDI_BN}, {0xfff9, 0xfffd, BIDI_ON}, {0xfffe, 0xffff, BIDI_BN}, {0x10101, 0x10101, BIDI_ON},
+	{0x10140, 0x1018c, BIDI_ON}, {0x10190, 0x1019c, BIDI_ON}, {0x101a0, 0x101a0, BIDI_ON}, {0x102e1, 0x102fb, BIDI_EN},
+	{0x10800, 0x1091e, BIDI_R}, {0x1091f, 0x1091f, BIDI_ON}, {0x10920, 0x10a00, BIDI_R}, {0x10a04, 0x10a04, BIDI_R},
+	{0x10a07, 0x10a0b, BIDI_R}, {0x10a10, 0x10a37, BIDI_R}, {0x10a3b, 0x10a3e, BIDI_R}, {0x10a40, 0x10ae4, BIDI_R},
+	{0x10ae7, 0x10b38, BIDI_R}, {0x10b39, 0x10b3f, BIDI_ON}, {0x10b40, 0x10cff, BIDI_R}, {0x10d00, 0x10d23, BIDI_AL},
+	{0x10d28, 0x10d2f, BIDI_R}, {0x10d30, 0x10d39, BIDI_AN}, {0x10d3a, 0x10e5f, BIDI_R}, {0x10e60, 0x10e7e, BIDI_AN},
+	{0x10e7f, 0x10eaa, BIDI_R}, {0x10ead, 0x10efc, BIDI_R}, {0x10f00, 0x10f2f, BIDI_R}, {0x10f30, 0x10f45, BIDI_AL},
+	{0x10f51, 0x10f59, BIDI_AL}, {0x10f5a, 0x10f81, BIDI_R}, {0x10f86, 0x10fff, BIDI_R}, {0x11052, 0x11065, BIDI_ON},
+	{0x113bb, 0x113c0, BIDI_L}, {0x113ce, 0x113ce, BIDI_L}, {0x113d0, 0x113d0, BIDI_L}, {0x113d2, 0x113d2, BIDI_L},
+	{0x113e1, 0x113e2, BIDI_L}, {0x11660, 0x1166c, BIDI_ON}, {0x1171e, 0x1171e, BIDI_NSM}, {0x11a07, 0x11a08, BIDI_L},
+	{0x11b60, 0x11b60, BIDI_L}, {0x11b62, 0x11b64, BIDI_L}, {0x11b66, 0x11b66, BIDI_L}, {0x11c3f, 0x11c3f, BIDI_L},
+	{0x11f5a, 0x11f5a, BIDI_L}, {0x11fd5, 0x11fdc, BIDI_ON}, {0x11fdd, 0x11fe0, BIDI_ET}, {0x11fe1, 0x11ff1, BIDI_ON},
+	{0x1611e, 0x16129, BIDI_L}, {0x1612d, 0x1612f, BIDI_L}, {0x16fe2, 0x16fe2, BIDI_ON}, {0x1bca0, 0x1bca3, BIDI_BN},
+	{0x1d173, 0x1d17a, BIDI_BN}, {0x1d1e9, 0x1d1ea, BIDI_ON}, {0x1d200, 0x1d241, BIDI_ON}, {0x1d245, 0x1d245, BIDI_ON},
+	{0x1d300, 0x1d356, BIDI_ON}, {0x1d6db, 0x1d6db, BIDI_ON}, {0x1d715, 0x1d715, BIDI_ON}, {0x1d74f, 0x1d74f, BIDI_ON},
+	{0x1d789, 0x1d789, BIDI_ON}, {0x1d7c3, 0x1d7c3, BIDI_ON}, {0x1d7ce, 0x1d7ff, BIDI_EN}, {0x1e2ff, 0x1e2ff, BIDI_ET},
+	{0x1e5ee, 0x1e5ef, BIDI_L}, {0x1e6e3, 0x1e6e3, BIDI_L}, {0x1e6e6, 0x1e6e6, BIDI_L}, {0x1e6ee, 0x1e6ef, BIDI_L},
+	{0x1e6f5, 0x1e6f5, BIDI_L}, {0x1e800, 0x1e8cf, BIDI_R}, {0x1e8d7, 0x1e943, BIDI_R}, {0x1e94b, 0x1ec70, BIDI_R},
+	{0x1ec71, 0x1ecb4, BIDI_AL}, {0x1ecb5, 0x1ed00, BIDI_R}, {0x1ed01, 0x1ed3d, BIDI_AL}, {0x1ed3e, 0x1edff, BIDI_R},
+	{0x1ee00, 0x1eeef, BIDI_AL}, {0x1eef0, 0x1eef1, BIDI_ON}, {0x1eef2, 0x1eeff, BIDI_AL}, {0x1ef00, 0x1efff, BIDI_R},
+	{0x1f000, 0x1f02b, BIDI_ON}, {0x1f030, 0x1f093, BIDI_ON}, {0x1f0a0, 0x1f0ae, BIDI_ON}, {0x1f0b1, 0x1f0bf, BIDI_ON},
+	{0x1f0c1, 0x1f0cf, BIDI_ON}, {0x1f0d1, 0x1f0f5, BIDI_ON}, {0x1f100, 0x1f10a, BIDI_EN}, {0x1f10b, 0x1f10f, BIDI_ON},
+	{0x1f12f, 0x1f12f, BIDI_ON}, {0x1f16a, 0x1f16f, BIDI_ON}, {0x1f1ad, 0x1f1ad, BIDI_ON}, {0x1f260, 0x1f265, BIDI_ON},
+	{0x1f300, 0x1f6d7, BIDI_ON}, {0x1f6dc, 0x1f6ec, BIDI_ON}, {0x1f6f0, 0x1f6fc, BIDI_ON}, {0x1f700, 0x1f776, BIDI_ON},
+	{0x1f77b, 0x1f7d9, BIDI_ON}, {0x1f7e0, 0x1f7eb, BIDI_ON}, {0x1f7f0, 0x1f7f0, BIDI_ON}, {0x1f800, 0x1f80b, BIDI_ON},
+	{0x1f810, 0x1f847, BIDI_ON}, {0x1f850, 0x1f859, BIDI_ON}, {0x1f860, 0x1f887, BIDI_ON}, {0x1f890, 0x1f8ad, BIDI_ON},
+	{0x1f8b0, 0x1f8b1, BIDI_ON}, {0x1f900, 0x1fa53, BIDI_ON}, {0x1fa60, 0x1fa6d, BIDI_ON}, {0x1fa70, 0x1fa7c, BIDI_ON},
+	{0x1fa80, 0x1fa88, BIDI_ON}, {0x1fa90, 0x1fabd, BIDI_ON}, {0x1fabf, 0x1fac5, BIDI_ON}, {0x1face, 0x1fadb, BIDI_ON},
+	{0x1fae0, 0x1fae8, BIDI_ON}, {0x1faf0, 0x1faf8, BIDI_ON}, {0x1fb00, 0x1fb92, BIDI_ON}, {0x1fb94, 0x1fbca, BIDI_ON},
+	{0x1fbf0, 0x1fbf9, BIDI_EN}, {0x1fffe, 0x1ffff, BIDI_BN}, {0x2fffe, 0x2ffff, BIDI_BN}, {0x3fffe, 0x3ffff, BIDI_BN},
+	{0x4fffe, 0x4ffff, BIDI_BN}, {0x5fffe, 0x5ffff, BIDI_BN}, {0x6fffe, 0x6ffff, BIDI_BN}, {0x7fffe, 0x7ffff, BIDI_BN},
+	{0x8fffe, 0x8ffff, BIDI_BN}, {0x9fffe, 0x9ffff, BIDI_BN}, {0xafffe, 0xaffff, BIDI_BN}, {0xbfffe, 0xbffff, BIDI_BN},
+	{0xcfffe, 0xcffff, BIDI_BN}, {0xdfffe, 0xe00ff, BIDI_BN}, {0xe01f0, 0xe0fff, BIDI_BN}, {0xefffe, 0xeffff, BIDI_BN},
+	{0xffffe, 0xfffff, BIDI_BN}, {0x10fffe, 0x10ffff, BIDI_BN},
+}
+
+// the opening brackets and their closing ones, for pairing them (N0)
+var BIDI_BRACKETS = map[rune]rune{
+	'(': ')', '[': ']', '{': '}', '༺': '༻', '༼': '༽', '᚛': '᚜', '⁅': '⁆', '⁽': '⁾',
+	'₍': '₎', '⌈': '⌉', '⌊': '⌋', '〈': '〉', '❨': '❩', '❪': '❫', '❬': '❭', '❮': '❯',
+	'❰': '❱', '❲': '❳', '❴': '❵', '⟅': '⟆', '⟦': '⟧', '⟨': '⟩', '⟪': '⟫', '⟬': '⟭',
+	'⟮': '⟯', '⦃': '⦄', '⦅': '⦆', '⦇': '⦈', '⦉': '⦊', '⦋': '⦌', '⦍': '⦐', '⦏': '⦎',
+	'⦑': '⦒', '⦓': '⦔', '⦕': '⦖', '⦗': '⦘', '⧘': '⧙', '⧚': '⧛', '⧼': '⧽', '⸢': '⸣',
+	'⸤': '⸥', '⸦': '⸧', '⸨': '⸩', '⹕': '⹖', '⹗': '⹘', '⹙': '⹚', '⹛': '⹜', '〈': '〉',
+	'《': '》', '「': '」', '『': '』', '【': '】', '〔': '〕', '〖': '〗', '〘': '〙', '〚': '〛',
+	'﹙': '﹚', '﹛': '﹜', '﹝': '﹞', '（': '）', '［': '］', '｛': '｝', '｟': '｠', '｢': '｣',
+}
+
+// the chars drawn as their mirror image in right to left text: the brackets and a few more
+var BIDI_MIRRORS = map[rune]rune{
+	'<': '>', '>': '<', '«': '»', '»': '«', '‹': '›', '›': '‹', '≤': '≥', '≥': '≤', '≪': '≫', '≫': '≪',
+}
+
+func init() {
+	for opening, closing := range BIDI_BRACKETS {
+		BIDI_MIRRORS[opening] = closing
+		BIDI_MIRRORS[closing] = opening
+	}
+}
+
+func BidiClassOf(char rune) BidiClass {
+	i := sort.Search(len(BIDI_RANGES), func(i int) bool { return BIDI_RANGES[i].Last >= char })
+	if i < len(BIDI_RANGES) && BIDI_RANGES[i].First <= char {
+		return BIDI_RANGES[i].Class
+	}
+	if unicode.In(char, unicode.Mn, unicode.Me) {
+		return BIDI_NSM
+	}
+	return BIDI_L
+}
+
+// whether any of runes can make the text go right to left, without them a left to right
+// paragraph is drawn in logical order
+func HasRightToLeft(runes []rune) bool {
+	for _, char := range runes {
+		switch BidiClassOf(char) {
+		case BIDI_R, BIDI_AL, BIDI_AN, BIDI_RLE, BIDI_RLO, BIDI_RLI, BIDI_FSI:
+			return true
+		}
+	}
+	return false
+}
+
+func isIsolateInitiator(class BidiClass) bool {
+	return class == BIDI_LRI || class == BIDI_RLI || class == BIDI_FSI
+}
+
+// the chars X9 takes out, the rules after it act as if they weren't there
+func isRemovedByX9(class BidiClass) bool {
+	switch class {
+	case BIDI_LRE, BIDI_RLE, BIDI_LRO, BIDI_RLO, BIDI_PDF, BIDI_BN:
+		return true
+	}
+	return false
+}
+
+// the neutral and isolate classes N1 and N2 resolve
+func isNeutralOrIsolate(class BidiClass) bool {
+	switch class {
+	case BIDI_B, BIDI_S, BIDI_WS, BIDI_ON, BIDI_LRI, BIDI_RLI, BIDI_FSI, BIDI_PDI:
+		return true
+	}
+	return false
+}
+
+func directionOfLevel(level int) BidiClass {
+	if level%2 == 1 {
+		return BIDI_R
+	}
+	return BIDI_L
+}
+
+// @paragraph
+type bidiParagraph struct {
+	runes       []rune
+	classes     []BidiClass // the original ones
+	types       []BidiClass // resolved by the rules
+	levels      []int
+	base        int
+	matchingPDI []int // for every isolate initiator, the index of its PDI or -1
+	initiatorOf []int // for every PDI, the index of its isolate initiator or -1
+}
+
+func newBidiParagraph(runes []rune) *bidiParagraph {
+	p := &bidiParagraph{
+		runes:       runes,
+		classes:     make([]BidiClass, len(runes)),
+		levels:      make([]int, len(runes)),
+		matchingPDI: make([]int, len(runes)),
+		initiatorOf: make([]int, len(runes)),
+	}
+	for i, char := range runes {
+		p.classes[i] = BidiClassOf(char)
+	}
+	p.types = slices.Clone(p.classes)
+	p.matchIsolates()
+	return p
+}
+
+// P2 and P3, the level of a paragraph from its first strong char: 1 when it's right to left, 0 otherwise.
+// It's the base the lines of the paragraph need for BidiLineLevels too
+func BidiParagraphLevel(runes []rune) int {
+	return newBidiParagraph(runes).firstStrongLevel(0, len(runes))
+}
+
+// Resolves the embedding level of every rune of a paragraph, which runes has without its line break.
+// base is the paragraph's level, 0 for left to right and 1 for right to left, or -1 to take it
+// from the paragraph's first strong char. The line rule L1 isn't applied, see BidiLineLevels
+func BidiLevels(runes []rune, base int) []int {
+	p := newBidiParagraph(runes)
+	p.base = base
+	if base < 0 {
+		p.base = p.firstStrongLevel(0, len(runes))
+	}
+	p.resolveExplicitLevels()
+	for _, sequence := range p.isolatingRunSequences() {
+		sequence.resolveWeakTypes()
+		sequence.resolvePairedBrackets()
+		sequence.resolveNeutralTypes()
+		sequence.resolveImplicitLevels()
+	}
+	// the removed chars get the level of the char before them, which keeps them next to it
+	for i, class := range p.classes {
+		if isRemovedByX9(class) {
+			p.levels[i] = p.base
+			if i > 0 {
+				p.levels[i] = p.levels[i-1]
+			}
+		}
+	}
+	return p.levels
+}
+
+// BD9, an isolate initiator matches the first PDI after it that isn't matched with another initiator
+func (p *bidiParagraph) matchIsolates() {
+	open := []int{}
+	for i, class := range p.classes {
+		p.matchingPDI[i] = -1
+		p.initiatorOf[i] = -1
+		if isIsolateInitiator(class) {
+			open = append(open, i)
+		} else if class == BIDI_PDI && len(open) > 0 {
+			initiator := open[len(open)-1]
+			open = open[:len(open)-1]
+			p.matchingPDI[initiator] = i
+			p.initiatorOf[i] = initiator
+		}
+	}
+}
+
+// P2 and P3, the level of the first strong char in [start, end) skipping isolated text, 0 without one
+func (p *bidiParagraph) firstStrongLevel(start int, end int) int {
+	for i := start; i < end; i++ {
+		switch p.classes[i] {
+		case BIDI_L:
+			return 0
+		case BIDI_R, BIDI_AL:
+			return 1
+		case BIDI_LRI, BIDI_RLI, BIDI_FSI:
+			if p.matchingPDI[i] == -1 {
+				return 0
+			}
+			i = p.matchingPDI[i]
+		}
+	}
+	return 0
+}
+
+// X1 to X8, the levels of the embeddings, overrides and isolates
+func (p *bidiParagraph) resolveExplicitLevels() {
+	type status struct {
+		level    int
+		override BidiClass // BIDI_ON when there's no override
+		isolate  bool
+	}
+	stack := []status{{p.base, BIDI_ON, false}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+	nextLevel := func(rightToLeft bool) int {
+		level := stack[len(stack)-1].level + 1
+		if (level%2 == 1) != rightToLeft {
+			level++
+		}
+		return level
+	}
+	for i, class := range p.classes {
+		top := stack[len(stack)-1]
+		p.levels[i] = top.level
+		switch class {
+		case BIDI_RLE, BIDI_LRE, BIDI_RLO, BIDI_LRO:
+			level := nextLevel(class == BIDI_RLE || class == BIDI_RLO)
+			if level <= MAX_BIDI_DEPTH && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				override := BIDI_ON
+				if class == BIDI_RLO {
+					override = BIDI_R
+				} else if class == BIDI_LRO {
+					override = BIDI_L
+				}
+				stack = append(stack, status{level, override, false})
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+		case BIDI_RLI, BIDI_LRI, BIDI_FSI:
+			if top.override != BIDI_ON {
+				p.types[i] = top.override
+			}
+			rightToLeft := class == BIDI_RLI
+			if class == BIDI_FSI {
+				end := p.matchingPDI[i]
+				if end == -1 {
+					end = len(p.classes)
+				}
+				rightToLeft = p.firstStrongLevel(i+1, end) == 1
+			}
+			level := nextLevel(rightToLeft)
+			if level <= MAX_BIDI_DEPTH && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, status{level, BIDI_ON, true})
+			} else {
+				overflowIsolates++
+			}
+		case BIDI_PDI:
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			top = stack[len(stack)-1]
+			p.levels[i] = top.level
+			if top.override != BIDI_ON {
+				p.types[i] = top.override
+			}
+		case BIDI_PDF:
+			if overflowIsolates > 0 {
+			} else if overflowEmbeddings > 0 {
+				overflowEmbeddings--
+			} else if !top.isolate && len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case BIDI_B:
+			p.levels[i] = p.base
+		case BIDI_BN:
+		default:
+			if top.override != BIDI_ON {
+				p.types[i] = top.override
+			}
+		}
+	}
+}
+
+// @isolating run sequences
+// A run of chars with the same level, joined with the runs after its isolates (X10).
+// The weak, neutral and implicit rules work on one at a time
+type bidiSequence struct {
+	p        *bidiParagraph
+	indexes  []int
+	level    int
+	sos, eos BidiClass // the direction at its start and its end
+}
+
+func (p *bidiParagraph) isolatingRunSequences() []*bidiSequence {
+	runs := [][]int{}
+	runOf := make([]int, len(p.classes))
+	for i, class := range p.classes {
+		if isRemovedByX9(class) {
+			continue
+		}
+		last := len(runs) - 1
+		if last >= 0 && p.levels[runs[last][len(runs[last])-1]] == p.levels[i] {
+			runs[last] = append(runs[last], i)
+		} else {
+			runs = append(runs, []int{i})
+			last++
+		}
+		runOf[i] = last
+	}
+
+	sequences := []*bidiSequence{}
+	for _, run := range runs {
+		first := run[0]
+		if p.classes[first] == BIDI_PDI && p.initiatorOf[first] != -1 {
+			// it goes in the sequence of its initiator
+			continue
+		}
+		indexes := slices.Clone(run)
+		for {
+			last := indexes[len(indexes)-1]
+			if !isIsolateInitiator(p.classes[last]) || p.matchingPDI[last] == -1 {
+				break
+			}
+			indexes = append(indexes, runs[runOf[p.matchingPDI[last]]]...)
+		}
+		sequences = append(sequences, p.newSequence(indexes))
+	}
+	return sequences
+}
+
+// the level of the first char that isn't removed going from i by step, the paragraph's without one
+func (p *bidiParagraph) levelNextTo(i int, step int) int {
+	for i += step; i >= 0 && i < len(p.classes); i += step {
+		if !isRemovedByX9(p.classes[i]) {
+			return p.levels[i]
+		}
+	}
+	return p.base
+}
+
+func (p *bidiParagraph) newSequence(indexes []int) *bidiSequence {
+	first, last := indexes[0], indexes[len(indexes)-1]
+	level := p.levels[first]
+	after := p.base
+	if !isIsolateInitiator(p.classes[last]) {
+		after = p.levelNextTo(last, 1)
+	}
+	return &bidiSequence{
+		p:       p,
+		indexes: indexes,
+		level:   level,
+		sos:     directionOfLevel(max(level, p.levelNextTo(first, -1))),
+		eos:     directionOfLevel(max(level, after)),
+	}
+}
+
+func (s *bidiSequence) typeAt(i int) BidiClass {
+	return s.p.types[s.indexes[i]]
+}
+
+func (s *bidiSequence) setType(i int, class BidiClass) {
+	s.p.types[s.indexes[i]] = class
+}
+
+// the first strong type before position i, EN and AN count as R when numbers is true, sos without one
+func (s *bidiSequence) strongBefore(i int, numbers bool) BidiClass {
+	for i--; i >= 0; i-- {
+		switch class := s.typeAt(i); class {
+		case BIDI_L, BIDI_R, BIDI_AL:
+			return class
+		case BIDI_EN, BIDI_AN:
+			if numbers {
+				return BIDI_R
+			}
+		}
+	}
+	return s.sos
+}
+
+// W1 to W7
+func (s *bidiSequence) resolveWeakTypes() {
+	n := len(s.indexes)
+	// W1, marks take the type of what they're on
+	for i := range n {
+		if s.typeAt(i) != BIDI_NSM {
+			continue
+		}
+		switch {
+		case i == 0:
+			s.setType(i, s.sos)
+		case isIsolateInitiator(s.typeAt(i-1)) || s.typeAt(i-1) == BIDI_PDI:
+			s.setType(i, BIDI_ON)
+		default:
+			s.setType(i, s.typeAt(i-1))
+		}
+	}
+	// W2 and W3, numbers after arabic letters are arabic numbers
+	for i := range n {
+		if s.typeAt(i) == BIDI_EN && s.strongBefore(i, false) == BIDI_AL {
+			s.setType(i, BIDI_AN)
+		}
+	}
+	for i := range n {
+		if s.typeAt(i) == BIDI_AL {
+			s.setType(i, BIDI_R)
+		}
+	}
+	// W4, a single separator between two numbers of the same kind
+	for i := 1; i < n-1; i++ {
+		before, class, after := s.typeAt(i-1), s.typeAt(i), s.typeAt(i+1)
+		if class == BIDI_ES && before == BIDI_EN && after == BIDI_EN {
+			s.setType(i, BIDI_EN)
+		} else if class == BIDI_CS && before == after && (before == BIDI_EN || before == BIDI_AN) {
+			s.setType(i, before)
+		}
+	}
+	// W5, terminators next to european numbers
+	for i := 0; i < n; i++ {
+		if s.typeAt(i) != BIDI_ET {
+			continue
+		}
+		end := i
+		for end < n && s.typeAt(end) == BIDI_ET {
+			end++
+		}
+		if i > 0 && s.typeAt(i-1) == BIDI_EN || end < n && s.typeAt(end) == BIDI_EN {
+			for j := i; j < end; j++ {
+				s.setType(j, BIDI_EN)
+			}
+		}
+		i = end
+	}
+	// W6 and W7
+	for i := range n {
+		switch s.typeAt(i) {
+		case BIDI_ES, BIDI_ET, BIDI_CS:
+			s.setType(i, BIDI_ON)
+		}
+	}
+	for i := range n {
+		if s.typeAt(i) == BIDI_EN && s.strongBefore(i, false) == BIDI_L {
+			s.setType(i, BIDI_L)
+		}
+	}
+}
+
+// the unicode brackets that are the same as another one
+func canonicalBracket(char rune) rune {
+	switch char {
+	case 0x2329:
+		return 0x3008
+	case 0x232a:
+		return 0x3009
+	}
+	return char
+}
+
+// N0, the brackets of a pair take the direction of the text inside them
+func (s *bidiSequence) resolvePairedBrackets() {
+	// BD16, at most 63 brackets are open at a time
+	type openBracket struct {
+		closing  rune
+		position int
+	}
+	type pair struct{ opening, closing int }
+	open := []openBracket{}
+	pairs := []pair{}
+brackets:
+	for i := range s.indexes {
+		if s.typeAt(i) != BIDI_ON {
+			continue
+		}
+		char := canonicalBracket(s.p.runes[s.indexes[i]])
+		if closing, ok := BIDI_BRACKETS[char]; ok {
+			if len(open) == 63 {
+				break brackets
+			}
+			open = append(open, openBracket{canonicalBracket(closing), i})
+			continue
+		}
+		for j := len(open) - 1; j >= 0; j-- {
+			if open[j].closing == char {
+				pairs = append(pairs, pair{open[j].position, i})
+				open = open[:j]
+				break
+			}
+		}
+	}
+	slices.SortFunc(pairs, func(a pair, b pair) int { return a.opening - b.opening })
+
+	embedding := directionOfLevel(s.level)
+	strongAt := func(i int) BidiClass {
+		switch class := s.typeAt(i); class {
+		case BIDI_EN, BIDI_AN:
+			return BIDI_R
+		case BIDI_L, BIDI_R:
+			return class
+		}
+		return BIDI_ON
+	}
+	for _, pair := range pairs {
+		direction := BIDI_ON
+		for i := pair.opening + 1; i < pair.closing; i++ {
+			strong := strongAt(i)
+			if strong == embedding {
+				direction = embedding
+				break
+			}
+			if strong != BIDI_ON {
+				direction = strong
+			}
+		}
+		if direction == BIDI_ON {
+			continue
+		}
+		if direction != embedding && s.strongBefore(pair.opening, true) != direction {
+			direction = embedding
+		}
+		for _, bracket := range []int{pair.opening, pair.closing} {
+			s.setType(bracket, direction)
+			// the marks on a bracket go with it
+			for i := bracket + 1; i < len(s.indexes) && s.p.classes[s.indexes[i]] == BIDI_NSM; i++ {
+				s.setType(i, direction)
+			}
+		}
+	}
+}
+
+// N1 and N2, neutrals between text of the same direction take it, the rest take the embedding's
+func (s *bidiSequence) resolveNeutralTypes() {
+	n := len(s.indexes)
+	direction := func(class BidiClass) BidiClass {
+		if class == BIDI_EN || class == BIDI_AN {
+			return BIDI_R
+		}
+		return class
+	}
+	for i := 0; i < n; i++ {
+		if !isNeutralOrIsolate(s.typeAt(i)) {
+			continue
+		}
+		end := i
+		for end < n && isNeutralOrIsolate(s.typeAt(end)) {
+			end++
+		}
+		before := s.sos
+		if i > 0 {
+			before = direction(s.typeAt(i - 1))
+		}
+		after := s.eos
+		if end < n {
+			after = direction(s.typeAt(end))
+		}
+		resolved := directionOfLevel(s.level)
+		if before == after {
+			resolved = before
+		}
+		for j := i; j < end; j++ {
+			s.setType(j, resolved)
+		}
+		i = end
+	}
+}
+
+// I1 and I2
+func (s *bidiSequence) resolveImplicitLevels() {
+	for i, index := range s.indexes {
+		class := s.typeAt(i)
+		level := s.level
+		if level%2 == 0 {
+			if class == BIDI_R {
+				level++
+			} else if class == BIDI_AN || class == BIDI_EN {
+				level += 2
+			}
+		} else if class == BIDI_L || class == BIDI_EN || class == BIDI_AN {
+			level++
+		}
+		s.p.levels[index] = level
+	}
+}
+
+// @lines
+// L1, the levels of a line of the paragraph, levels being the line's part of what BidiLevels resolved
+// and base the paragraph's level: separators and the whitespace before them or at the end of the line go back to it
+func BidiLineLevels(line []rune, levels []int, base int) []int {
+	levels = slices.Clone(levels)
+	trailing := true
+	for i := len(line) - 1; i >= 0; i-- {
+		switch class := BidiClassOf(line[i]); {
+		case class == BIDI_S || class == BIDI_B:
+			levels[i] = base
+			trailing = true
+		case class == BIDI_WS || isIsolateInitiator(class) || class == BIDI_PDI || isRemovedByX9(class):
+			if trailing {
+				levels[i] = base
+			}
+		default:
+			trailing = false
+		}
+	}
+	return levels
+}
+
+// L2, the indexes of the line's items from left to right, every item having its level
+func BidiVisualOrder(levels []int) []int {
+	order := make([]int, len(levels))
+	highest, lowestOdd := 0, MAX_BIDI_DEPTH+2
+	for i, level := range levels {
+		order[i] = i
+		highest = max(highest, level)
+		if level%2 == 1 {
+			lowestOdd = min(lowestOdd, level)
+		}
+	}
+	// from the highest level to the lowest odd one, every run at that level or above is reversed
+	for level := highest; level >= lowestOdd; level-- {
+		for i := 0; i < len(order); i++ {
+			if levels[order[i]] < level {
+				continue
+			}
+			end := i
+			for end < len(order) && levels[order[end]] >= level {
+				end++
+			}
+			slices.Reverse(order[i:end])
+			i = end
+		}
+	}
+	return order
+}
+
+// @visual clusters
+// where a cluster of a line is drawn, Start is its column
+type VisualCluster struct {
+	Start, Length int
+	X, Width      float32
+	RightToLeft   bool
+}
+
+// Lays out the clusters of a line from left to right starting at x, levels being the line's from
+// BidiLineLevels and width the width of a cluster from its first char and where it is in logical order,
+// so tabs keep the width they have there. nil when nothing in the line is right to left
+func VisualClusters(line []rune, levels []int, x float32, width func(char rune, logicalX float32) float32) []VisualCluster {
+	clusters := []VisualCluster{}
+	clusterLevels := []int{}
+	rightToLeft := false
+	var logicalX float32
+	var segmenter GraphemeSegmenter
+	for column, char := range line {
+		if !segmenter.IsBoundary(char) {
+			clusters[len(clusters)-1].Length++
+			continue
+		}
+		// a cluster has the level of its first char, the marks on it can't go anywhere else
+		clusters = append(clusters, VisualCluster{
+			Start:       column,
+			Length:      1,
+			Width:       width(char, logicalX),
+			RightToLeft: levels[column]%2 == 1,
+		})
+		logicalX += clusters[len(clusters)-1].Width
+		clusterLevels = append(clusterLevels, levels[column])
+		rightToLeft = rightToLeft || levels[column]%2 == 1
+	}
+	if !rightToLeft {
+		return nil
+	}
+	visual := make([]VisualCluster, len(clusters))
+	for i, index := range BidiVisualOrder(clusterLevels) {
+		visual[i] = clusters[index]
+		visual[i].X = x
+		x += visual[i].Width
+	}
+	return visual
+}
+
+// Where the cursor at column is drawn on a line laid out as clusters, x being where it is in logical order.
+// It goes next to the cluster before it, on the side that cluster's text goes towards,
+// or before the line's first cluster
+func VisualCursorX(clusters []VisualCluster, column int, x float32) float32 {
+	for _, cluster := range clusters {
+		if cluster.Start+cluster.Length != column {
+			continue
+		}
+		if cluster.RightToLeft {
+			return cluster.X
+		}
+		return cluster.X + cluster.Width
+	}
+	for _, cluster := range clusters {
+		if cluster.Start != column {
+			continue
+		}
+		if cluster.RightToLeft {
+			return cluster.X + cluster.Width
+		}
+		return cluster.X
+	}
+	return x
+}
+
+// the column a click at x on a line laid out as clusters goes to
+func VisualClickColumn(clusters []VisualCluster, x float32) int {
+	for i, cluster := range clusters {
+		if x >= cluster.X+cluster.Width && i < len(clusters)-1 {
+			continue
+		}
+		// the half of the cluster its text starts at is before it, the other half is after it
+		leftHalf := x < cluster.X+cluster.Width/2
+		if leftHalf != cluster.RightToLeft {
+			return cluster.Start
+		}
+		return cluster.Start + cluster.Length
+	}
+	return 0
+}
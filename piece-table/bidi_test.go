@@ -0,0 +1,205 @@
+package piecetable
+
+import (
+	"bufio"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type bidiCharacterTest struct {
+	runes     []rune
+	direction int // 2 takes it from the text
+	level     int
+	levels    []int // -1 for the removed runes
+	order     []int
+}
+
+// reads the lines of BidiCharacterTest.txt
+func readBidiCharacterTest(t *testing.T) []bidiCharacterTest {
+	t.Helper()
+	file, err := os.Open("testdata/BidiCharacterTest.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	numbers := func(field string, base int) []int {
+		values := []int{}
+		for _, number := range strings.Fields(field) {
+			if number == "x" {
+				values = append(values, -1)
+				continue
+			}
+			value, err := strconv.ParseInt(number, base, 32)
+			if err != nil {
+				t.Fatalf("bad number %q in %q", number, field)
+			}
+			values = append(values, int(value))
+		}
+		return values
+	}
+	tests := []bidiCharacterTest{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ";")
+		if len(fields) != 5 {
+			t.Fatalf("%q doesn't have 5 fields", line)
+		}
+		test := bidiCharacterTest{
+			direction: numbers(fields[1], 10)[0],
+			level:     numbers(fields[2], 10)[0],
+			levels:    numbers(fields[3], 10),
+			order:     numbers(fields[4], 10),
+		}
+		for _, char := range numbers(fields[0], 16) {
+			test.runes = append(test.runes, rune(char))
+		}
+		tests = append(tests, test)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return tests
+}
+
+func TestBidiCharacterTest(t *testing.T) {
+	for _, test := range readBidiCharacterTest(t) {
+		base := test.direction
+		if base == 2 {
+			base = BidiParagraphLevel(test.runes)
+		}
+		if base != test.level {
+			t.Errorf("%+q has level %d, want %d", string(test.runes), base, test.level)
+			continue
+		}
+		levels := BidiLineLevels(test.runes, BidiLevels(test.runes, base), base)
+		// the removed runes have no level of their own, nor a place in the order
+		kept := []int{}
+		keptLevels := []int{}
+		for i, level := range test.levels {
+			if level == -1 {
+				continue
+			}
+			if levels[i] != level {
+				t.Errorf("%+q has levels %v, want %v", string(test.runes), levels, test.levels)
+				break
+			}
+			kept = append(kept, i)
+			keptLevels = append(keptLevels, level)
+		}
+		order := []int{}
+		for _, index := range BidiVisualOrder(keptLevels) {
+			order = append(order, kept[index])
+		}
+		if !slices.Equal(order, test.order) {
+			t.Errorf("%+q is drawn in the order %v, want %v", string(test.runes), order, test.order)
+		}
+	}
+}
+
+func TestBidiLevelsTakeTheBase(t *testing.T) {
+	runes := []rune("1 אב (c)")
+	if level := BidiParagraphLevel(runes); level != 1 {
+		t.Fatalf("the paragraph level is %d, want 1", level)
+	}
+	if !slices.Equal(BidiLevels(runes, -1), BidiLevels(runes, 1)) {
+		t.Errorf("base -1 resolves %v, base 1 %v", BidiLevels(runes, -1), BidiLevels(runes, 1))
+	}
+}
+
+// a wrapped paragraph: only the whitespace at the end of each line goes back to the paragraph's level
+func TestBidiLineLevels(t *testing.T) {
+	runes := []rune("אב גד הו")
+	levels := BidiLevels(runes, 0)
+	first := BidiLineLevels(runes[:3], levels[:3], 0)
+	if want := []int{1, 1, 0}; !slices.Equal(first, want) {
+		t.Errorf("the first line has levels %v, want %v", first, want)
+	}
+	second := BidiLineLevels(runes[3:], levels[3:], 0)
+	if want := []int{1, 1, 1, 1, 1}; !slices.Equal(second, want) {
+		t.Errorf("the second line has levels %v, want %v", second, want)
+	}
+}
+
+// the line "ab אבג 12" with clusters 10 wide starting at 100 is drawn as "ab 12 גבא"
+func TestVisualClusters(t *testing.T) {
+	line := []rune("ab אבג 12")
+	levels := BidiLineLevels(line, BidiLevels(line, -1), BidiParagraphLevel(line))
+	width := func(char rune, logicalX float32) float32 { return 10 }
+	clusters := VisualClusters(line, levels, 100, width)
+	starts := []int{}
+	for i, cluster := range clusters {
+		starts = append(starts, cluster.Start)
+		if cluster.X != 100+float32(i)*10 {
+			t.Errorf("cluster %d is at %v, want %v", i, cluster.X, 100+float32(i)*10)
+		}
+	}
+	if want := []int{0, 1, 2, 7, 8, 6, 5, 4, 3}; !slices.Equal(starts, want) {
+		t.Fatalf("the clusters are drawn in the order %v, want %v", starts, want)
+	}
+
+	cursors := []struct {
+		column int
+		x      float32
+	}{
+		{0, 100},
+		{3, 130}, // after the space, before the hebrew that's drawn at the end
+		{4, 180}, // after the first hebrew letter, at its left
+		{6, 160},
+		{7, 150}, // after the right to left space
+		{8, 140},
+		{9, 150},
+	}
+	for _, c := range cursors {
+		if x := VisualCursorX(clusters, c.column, 0); x != c.x {
+			t.Errorf("the cursor at column %d is drawn at %v, want %v", c.column, x, c.x)
+		}
+	}
+
+	clicks := []struct {
+		x      float32
+		column int
+	}{
+		{50, 0},
+		{104, 0},
+		{106, 1},
+		{133, 7},
+		{137, 8},
+		{152, 7}, // the left half of a right to left cluster is after it
+		{155, 6},
+		{183, 4},
+		{187, 3},
+		{500, 3},
+	}
+	for _, c := range clicks {
+		if column := VisualClickColumn(clusters, c.x); column != c.column {
+			t.Errorf("a click at %v goes to column %d, want %d", c.x, column, c.column)
+		}
+	}
+}
+
+func TestVisualClustersKeepMarks(t *testing.T) {
+	line := []rune("a אָב")
+	levels := BidiLineLevels(line, BidiLevels(line, 0), 0)
+	clusters := VisualClusters(line, levels, 0, func(char rune, logicalX float32) float32 { return 10 })
+	want := []VisualCluster{
+		{Start: 0, Length: 1, X: 0, Width: 10},
+		{Start: 1, Length: 1, X: 10, Width: 10},
+		{Start: 4, Length: 1, X: 20, Width: 10, RightToLeft: true},
+		{Start: 2, Length: 2, X: 30, Width: 10, RightToLeft: true},
+	}
+	if !slices.Equal(clusters, want) {
+		t.Errorf("the clusters are %+v, want %+v", clusters, want)
+	}
+	// a left to right line is drawn in logical order
+	line = []rune("abc (1)")
+	if clusters := VisualClusters(line, BidiLevels(line, 0), 0, func(char rune, logicalX float32) float32 { return 10 }); clusters != nil {
+		t.Errorf("a left to right line has clusters %+v", clusters)
+	}
+}
@@ -0,0 +1,303 @@
+package piecetable
+
+import "unicode"
+
+// Grapheme clusters are what a user sees as a single char: a letter with its combining marks,
+// a hangul syllable written with jamos, an emoji joined with ZWJs or a flag made of two regional
+// indicators. The boundaries follow the extended grapheme cluster rules of UAX #29, with the
+// break properties derived from the unicode tables Go has, which is close enough for an editor.
+// Cursors stop only at the boundaries, so a cluster is moved over and deleted whole.
+
+type GraphemeBreak = int
+
+const (
+	OTHER_BREAK GraphemeBreak = iota
+	CR_BREAK
+	LF_BREAK
+	CONTROL_BREAK
+	EXTEND_BREAK
+	ZWJ_BREAK
+	REGIONAL_INDICATOR_BREAK
+	PREPEND_BREAK
+	SPACING_MARK_BREAK
+	L_BREAK // hangul leading jamo
+	V_BREAK // hangul vowel jamo
+	T_BREAK // hangul trailing jamo
+	LV_BREAK
+	LVT_BREAK
+	PICTOGRAPHIC_BREAK // Extended_Pictographic, the emojis and the symbols that can become one
+)
+
+const (
+	ZWJ  = '\u200d'
+	ZWNJ = '\u200c'
+)
+
+// the format chars that go before what they apply to, like the arabic number sign
+var PREPEND_CHARS = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x0600, 0x0605, 1}, {0x06dd, 0x06dd, 1}, {0x070f, 0x070f, 1},
+		{0x0890, 0x0891, 1}, {0x08e2, 0x08e2, 1}, {0x0d4e, 0x0d4e, 1},
+	},
+	R32: []unicode.Range32{
+		{0x110bd, 0x110bd, 1}, {0x110cd, 0x110cd, 1}, {0x111c2, 0x111c3, 1},
+		{0x1193f, 0x1193f, 1}, {0x11941, 0x11941, 1}, {0x11a3a, 0x11a3a, 1},
+		{0x11a84, 0x11a89, 1}, {0x11d46, 0x11d46, 1},
+	},
+}
+
+// Extended_Pictographic isn't in Go's tables, these are its blocks with the ascii and latin-1 symbols left out
+var PICTOGRAPHIC_CHARS = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00a9, 0x00a9, 1}, {0x00ae, 0x00ae, 1}, {0x203c, 0x203c, 1}, {0x2049, 0x2049, 1},
+		{0x2122, 0x2122, 1}, {0x2139, 0x2139, 1}, {0x2194, 0x2199, 1}, {0x21a9, 0x21aa, 1},
+		{0x231a, 0x231b, 1}, {0x2328, 0x2328, 1}, {0x2388, 0x2388, 1}, {0x23cf, 0x23cf, 1},
+		{0x23e9, 0x23f3, 1}, {0x23f8, 0x23fa, 1}, {0x24c2, 0x24c2, 1}, {0x25aa, 0x25ab, 1},
+		{0x25b6, 0x25b6, 1}, {0x25c0, 0x25c0, 1}, {0x25fb, 0x25fe, 1}, {0x2600, 0x2605, 1},
+		{0x2607, 0x2612, 1}, {0x2614, 0x2685, 1}, {0x2690, 0x2705, 1}, {0x2708, 0x2712, 1},
+		{0x2714, 0x2714, 1}, {0x2716, 0x2716, 1}, {0x271d, 0x271d, 1}, {0x2721, 0x2721, 1},
+		{0x2728, 0x2728, 1}, {0x2733, 0x2734, 1}, {0x2744, 0x2744, 1}, {0x2747, 0x2747, 1},
+		{0x274c, 0x274c, 1}, {0x274e, 0x274e, 1}, {0x2753, 0x2755, 1}, {0x2757, 0x2757, 1},
+		{0x2763, 0x2767, 1}, {0x2795, 0x2797, 1}, {0x27a1, 0x27a1, 1}, {0x27b0, 0x27b0, 1},
+		{0x27bf, 0x27bf, 1}, {0x2934, 0x2935, 1}, {0x2b05, 0x2b07, 1}, {0x2b1b, 0x2b1c, 1},
+		{0x2b50, 0x2b50, 1}, {0x2b55, 0x2b55, 1}, {0x3030, 0x3030, 1}, {0x303d, 0x303d, 1},
+		{0x3297, 0x3297, 1}, {0x3299, 0x3299, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1f000, 0x1f0ff, 1}, {0x1f10d, 0x1f10f, 1}, {0x1f12f, 0x1f12f, 1}, {0x1f16c, 0x1f171, 1},
+		{0x1f17e, 0x1f17f, 1}, {0x1f18e, 0x1f18e, 1}, {0x1f191, 0x1f19a, 1}, {0x1f1ad, 0x1f1e5, 1},
+		{0x1f201, 0x1f20f, 1}, {0x1f21a, 0x1f21a, 1}, {0x1f22f, 0x1f22f, 1}, {0x1f232, 0x1f23a, 1},
+		{0x1f23c, 0x1f23f, 1}, {0x1f249, 0x1f3fa, 1}, {0x1f400, 0x1f53d, 1}, {0x1f546, 0x1f64f, 1},
+		{0x1f680, 0x1f6ff, 1}, {0x1f774, 0x1f77f, 1}, {0x1f7d5, 0x1f7ff, 1}, {0x1f80c, 0x1f80f, 1},
+		{0x1f848, 0x1f84f, 1}, {0x1f85a, 0x1f85f, 1}, {0x1f888, 0x1f88f, 1}, {0x1f8ae, 0x1f8ff, 1},
+		{0x1f90c, 0x1f93a, 1}, {0x1f93c, 0x1f945, 1}, {0x1f947, 0x1faff, 1}, {0x1fc00, 0x1fffd, 1},
+	},
+}
+
+// The Indic_Conjunct_Break property of unicode 15.1, for the scripts that join consonants with a virama
+// (devanagari, bengali, gujarati, oriya, telugu and malayalam). Its Extend chars are the
+// EXTEND_BREAK and ZWJ_BREAK ones that aren't linkers
+var CONJUNCT_LINKERS = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x094d, 0x094d, 1}, {0x09cd, 0x09cd, 1}, {0x0acd, 0x0acd, 1},
+		{0x0b4d, 0x0b4d, 1}, {0x0c4d, 0x0c4d, 1}, {0x0d4d, 0x0d4d, 1},
+	},
+}
+
+var CONJUNCT_CONSONANTS = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x0915, 0x0939, 1}, {0x0958, 0x095f, 1}, {0x0978, 0x097f, 1}, {0x0995, 0x09a8, 1},
+		{0x09aa, 0x09b0, 1}, {0x09b2, 0x09b2, 1}, {0x09b6, 0x09b9, 1}, {0x09dc, 0x09dd, 1},
+		{0x09df, 0x09df, 1}, {0x09f0, 0x09f1, 1}, {0x0a95, 0x0aa8, 1}, {0x0aaa, 0x0ab0, 1},
+		{0x0ab2, 0x0ab3, 1}, {0x0ab5, 0x0ab9, 1}, {0x0af9, 0x0af9, 1}, {0x0b15, 0x0b28, 1},
+		{0x0b2a, 0x0b30, 1}, {0x0b32, 0x0b33, 1}, {0x0b35, 0x0b39, 1}, {0x0b5c, 0x0b5d, 1},
+		{0x0b5f, 0x0b5f, 1}, {0x0b71, 0x0b71, 1}, {0x0c15, 0x0c28, 1}, {0x0c2a, 0x0c39, 1},
+		{0x0c58, 0x0c5a, 1}, {0x0d15, 0x0d3a, 1},
+	},
+}
+
+const (
+	HANGUL_SYLLABLE_START = 0xac00
+	HANGUL_SYLLABLE_END   = 0xd7a3
+	HANGUL_T_COUNT        = 28 // every LV syllable is followed by its 27 LVT syllables
+)
+
+func GraphemeBreakOf(char rune) GraphemeBreak {
+	switch {
+	case char == '\r':
+		return CR_BREAK
+	case char == '\n':
+		return LF_BREAK
+	case char == ZWJ:
+		return ZWJ_BREAK
+	case unicode.Is(PREPEND_CHARS, char):
+		return PREPEND_BREAK
+	// the emoji skin tones are symbols but they extend the emoji before them
+	case char == ZWNJ || unicode.In(char, unicode.Mn, unicode.Me, unicode.Other_Grapheme_Extend) || char >= 0x1f3fb && char <= 0x1f3ff:
+		return EXTEND_BREAK
+	case unicode.In(char, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp):
+		return CONTROL_BREAK
+	case char >= 0x1f1e6 && char <= 0x1f1ff:
+		return REGIONAL_INDICATOR_BREAK
+	case unicode.Is(unicode.Mc, char) || char == 0x0e33 || char == 0x0eb3:
+		return SPACING_MARK_BREAK
+	case char >= 0x1100 && char <= 0x115f || char >= 0xa960 && char <= 0xa97c:
+		return L_BREAK
+	case char >= 0x1160 && char <= 0x11a7 || char >= 0xd7b0 && char <= 0xd7c6:
+		return V_BREAK
+	case char >= 0x11a8 && char <= 0x11ff || char >= 0xd7cb && char <= 0xd7fb:
+		return T_BREAK
+	case char >= HANGUL_SYLLABLE_START && char <= HANGUL_SYLLABLE_END:
+		if (char-HANGUL_SYLLABLE_START)%HANGUL_T_COUNT == 0 {
+			return LV_BREAK
+		}
+		return LVT_BREAK
+	case unicode.Is(PICTOGRAPHIC_CHARS, char):
+		return PICTOGRAPHIC_BREAK
+	}
+	return OTHER_BREAK
+}
+
+// Finds the cluster boundaries of runes fed to it in order, from the start of a cluster
+type GraphemeSegmenter struct {
+	previous           GraphemeBreak
+	started            bool
+	pictographic       bool // the cluster so far ends with a pictographic and its extends
+	joinedPictographic bool // the previous rune is a ZWJ right after a pictographic
+	regionalIndicators int  // how many regional indicators there are right before
+	conjunct           bool // the cluster so far ends with a consonant and its extends
+	linkedConjunct     bool // and there is a linker among them, so a consonant after joins the cluster
+}
+
+// whether a cluster starts at char, which is the rune after the ones fed before
+func (s *GraphemeSegmenter) IsBoundary(char rune) bool {
+	class := GraphemeBreakOf(char)
+	consonant := unicode.Is(CONJUNCT_CONSONANTS, char)
+	boundary := !s.started || s.breaksBefore(class, consonant)
+	s.started = true
+
+	switch {
+	case consonant:
+		s.conjunct, s.linkedConjunct = true, false
+	case unicode.Is(CONJUNCT_LINKERS, char):
+		s.linkedConjunct = s.conjunct
+	case class != EXTEND_BREAK && class != ZWJ_BREAK || char == ZWNJ:
+		s.conjunct, s.linkedConjunct = false, false
+	}
+
+	s.joinedPictographic = class == ZWJ_BREAK && s.pictographic
+	switch class {
+	case PICTOGRAPHIC_BREAK:
+		s.pictographic = true
+	case EXTEND_BREAK:
+	default:
+		s.pictographic = false
+	}
+	if class == REGIONAL_INDICATOR_BREAK {
+		s.regionalIndicators++
+	} else {
+		s.regionalIndicators = 0
+	}
+	s.previous = class
+	return boundary
+}
+
+func (s *GraphemeSegmenter) breaksBefore(class GraphemeBreak, consonant bool) bool {
+	previous := s.previous
+	isControl := func(class GraphemeBreak) bool {
+		return class == CONTROL_BREAK || class == CR_BREAK || class == LF_BREAK
+	}
+	switch {
+	case previous == CR_BREAK && class == LF_BREAK: // GB3
+		return false
+	case isControl(previous) || isControl(class): // GB4, GB5
+		return true
+	case previous == L_BREAK && (class == L_BREAK || class == V_BREAK || class == LV_BREAK || class == LVT_BREAK): // GB6
+		return false
+	case (previous == LV_BREAK || previous == V_BREAK) && (class == V_BREAK || class == T_BREAK): // GB7
+		return false
+	case (previous == LVT_BREAK || previous == T_BREAK) && class == T_BREAK: // GB8
+		return false
+	case class == EXTEND_BREAK || class == ZWJ_BREAK || class == SPACING_MARK_BREAK: // GB9, GB9a
+		return false
+	case previous == PREPEND_BREAK: // GB9b
+		return false
+	case s.linkedConjunct && consonant: // GB9c
+		return false
+	case s.joinedPictographic && class == PICTOGRAPHIC_BREAK: // GB11
+		return false
+	case previous == REGIONAL_INDICATOR_BREAK && class == REGIONAL_INDICATOR_BREAK: // GB12, GB13
+		return s.regionalIndicators%2 == 0
+	}
+	return true
+}
+
+// the longest cluster looked back for, clusters can be longer but only made up ones are
+const MAX_GRAPHEME_LOOKBEHIND = 64
+
+// position right after the cluster that starts at position
+func (pt *PieceTable) NextGraphemeBoundary(position uint) uint {
+	var segmenter GraphemeSegmenter
+	for i, char := range pt.RunesFrom(position) {
+		if segmenter.IsBoundary(char) && uint(i) > position {
+			return uint(i)
+		}
+	}
+	return pt.RuneLength
+}
+
+// Position where the cluster that ends at position starts. Clusters can only be found going forward,
+// so it goes back to a line break (which is always a boundary) or MAX_GRAPHEME_LOOKBEHIND runes and segments from there
+func (pt *PieceTable) PreviousGraphemeBoundary(position uint) uint {
+	position = min(position, pt.RuneLength)
+	if position == 0 {
+		return 0
+	}
+	start := position - 1
+	for i, char := range pt.RunesBefore(position - 1) {
+		if char == '\n' || position-uint(i) > MAX_GRAPHEME_LOOKBEHIND {
+			break
+		}
+		start = uint(i)
+	}
+	var segmenter GraphemeSegmenter
+	boundary := start
+	for i, char := range pt.RunesFrom(start) {
+		if uint(i) >= position {
+			break
+		}
+		if segmenter.IsBoundary(char) {
+			boundary = uint(i)
+		}
+	}
+	return boundary
+}
+
+// @wide chars
+// East Asian Wide and Fullwidth chars of unicode 15, which take two cells of a monospace grid
+var WIDE_CHARS = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1}, {0x231a, 0x231b, 1}, {0x2329, 0x232a, 1}, {0x23e9, 0x23ec, 1},
+		{0x23f0, 0x23f0, 1}, {0x23f3, 0x23f3, 1}, {0x25fd, 0x25fe, 1}, {0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1}, {0x267f, 0x267f, 1}, {0x2693, 0x2693, 1}, {0x26a1, 0x26a1, 1},
+		{0x26aa, 0x26ab, 1}, {0x26bd, 0x26be, 1}, {0x26c4, 0x26c5, 1}, {0x26ce, 0x26ce, 1},
+		{0x26d4, 0x26d4, 1}, {0x26ea, 0x26ea, 1}, {0x26f2, 0x26f3, 1}, {0x26f5, 0x26f5, 1},
+		{0x26fa, 0x26fa, 1}, {0x26fd, 0x26fd, 1}, {0x2705, 0x2705, 1}, {0x270a, 0x270b, 1},
+		{0x2728, 0x2728, 1}, {0x274c, 0x274c, 1}, {0x274e, 0x274e, 1}, {0x2753, 0x2755, 1},
+		{0x2757, 0x2757, 1}, {0x2795, 0x2797, 1}, {0x27b0, 0x27b0, 1}, {0x27bf, 0x27bf, 1},
+		{0x2b1b, 0x2b1c, 1}, {0x2b50, 0x2b50, 1}, {0x2b55, 0x2b55, 1}, {0x2e80, 0x2e99, 1},
+		{0x2e9b, 0x2ef3, 1}, {0x2f00, 0x2fd5, 1}, {0x2ff0, 0x2ffb, 1}, {0x3000, 0x303e, 1},
+		{0x3041, 0x3096, 1}, {0x3099, 0x30ff, 1}, {0x3105, 0x312f, 1}, {0x3131, 0x318e, 1},
+		{0x3190, 0x31e3, 1}, {0x31f0, 0x321e, 1}, {0x3220, 0x3247, 1}, {0x3250, 0x4dbf, 1},
+		{0x4e00, 0xa48c, 1}, {0xa490, 0xa4c6, 1}, {0xa960, 0xa97c, 1}, {0xac00, 0xd7a3, 1},
+		{0xf900, 0xfaff, 1}, {0xfe10, 0xfe19, 1}, {0xfe30, 0xfe52, 1}, {0xfe54, 0xfe66, 1},
+		{0xfe68, 0xfe6b, 1}, {0xff01, 0xff60, 1}, {0xffe0, 0xffe6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x16fe0, 0x16fe4, 1}, {0x16ff0, 0x16ff1, 1}, {0x17000, 0x187f7, 1}, {0x18800, 0x18cd5, 1},
+		{0x18d00, 0x18d08, 1}, {0x1aff0, 0x1aff3, 1}, {0x1aff5, 0x1affb, 1}, {0x1affd, 0x1affe, 1},
+		{0x1b000, 0x1b122, 1}, {0x1b132, 0x1b132, 1}, {0x1b150, 0x1b152, 1}, {0x1b155, 0x1b155, 1},
+		{0x1b164, 0x1b167, 1}, {0x1b170, 0x1b2fb, 1}, {0x1f004, 0x1f004, 1}, {0x1f0cf, 0x1f0cf, 1},
+		{0x1f18e, 0x1f18e, 1}, {0x1f191, 0x1f19a, 1}, {0x1f200, 0x1f202, 1}, {0x1f210, 0x1f23b, 1},
+		{0x1f240, 0x1f248, 1}, {0x1f250, 0x1f251, 1}, {0x1f260, 0x1f265, 1}, {0x1f300, 0x1f320, 1},
+		{0x1f32d, 0x1f335, 1}, {0x1f337, 0x1f37c, 1}, {0x1f37e, 0x1f393, 1}, {0x1f3a0, 0x1f3ca, 1},
+		{0x1f3cf, 0x1f3d3, 1}, {0x1f3e0, 0x1f3f0, 1}, {0x1f3f4, 0x1f3f4, 1}, {0x1f3f8, 0x1f43e, 1},
+		{0x1f440, 0x1f440, 1}, {0x1f442, 0x1f4fc, 1}, {0x1f4ff, 0x1f53d, 1}, {0x1f54b, 0x1f54e, 1},
+		{0x1f550, 0x1f567, 1}, {0x1f57a, 0x1f57a, 1}, {0x1f595, 0x1f596, 1}, {0x1f5a4, 0x1f5a4, 1},
+		{0x1f5fb, 0x1f64f, 1}, {0x1f680, 0x1f6c5, 1}, {0x1f6cc, 0x1f6cc, 1}, {0x1f6d0, 0x1f6d2, 1},
+		{0x1f6d5, 0x1f6d7, 1}, {0x1f6dc, 0x1f6df, 1}, {0x1f6eb, 0x1f6ec, 1}, {0x1f6f4, 0x1f6fc, 1},
+		{0x1f7e0, 0x1f7eb, 1}, {0x1f7f0, 0x1f7f0, 1}, {0x1f90c, 0x1f93a, 1}, {0x1f93c, 0x1f945, 1},
+		{0x1f947, 0x1f9ff, 1}, {0x1fa70, 0x1fa7c, 1}, {0x1fa80, 0x1fa88, 1}, {0x1fa90, 0x1fabd, 1},
+		{0x1fabf, 0x1fac5, 1}, {0x1face, 0x1fadb, 1}, {0x1fae0, 0x1fae8, 1}, {0x1faf0, 0x1faf8, 1},
+		{0x20000, 0x2fffd, 1}, {0x30000, 0x3fffd, 1},
+	},
+}
+
+// the cells a cluster starting with char takes in a monospace grid, the regional indicators
+// are wide because they're only drawn in pairs, as a flag
+func CellWidth(char rune) int {
+	if unicode.Is(WIDE_CHARS, char) || char >= 0x1f1e6 && char <= 0x1f1ff {
+		return 2
+	}
+	return 1
+}
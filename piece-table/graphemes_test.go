@@ -0,0 +1,182 @@
+package piecetable
+
+import (
+	"bufio"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// reads the lines of GraphemeBreakTest.txt as their text and the boundaries in it, as rune positions
+func readGraphemeBreakTest(t *testing.T) ([]string, [][]int) {
+	t.Helper()
+	file, err := os.Open("testdata/GraphemeBreakTest.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	texts := []string{}
+	boundaries := [][]int{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		runes := []rune{}
+		lineBoundaries := []int{}
+		for _, field := range fields {
+			switch field {
+			case "÷":
+				lineBoundaries = append(lineBoundaries, len(runes))
+			case "×":
+			default:
+				char, err := strconv.ParseUint(field, 16, 32)
+				if err != nil {
+					t.Fatalf("bad code point %q in %q", field, line)
+				}
+				runes = append(runes, rune(char))
+			}
+		}
+		texts = append(texts, string(runes))
+		boundaries = append(boundaries, lineBoundaries)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return texts, boundaries
+}
+
+func TestGraphemeBreakTest(t *testing.T) {
+	texts, boundaries := readGraphemeBreakTest(t)
+	for i, text := range texts {
+		want := boundaries[i]
+		got := []int{}
+		var segmenter GraphemeSegmenter
+		for position, char := range []rune(text) {
+			if segmenter.IsBoundary(char) {
+				got = append(got, position)
+			}
+		}
+		got = append(got, len([]rune(text)))
+		if !slices.Equal(got, want) {
+			t.Errorf("%+q has boundaries %v, want %v", text, got, want)
+			continue
+		}
+
+		// the piece table finds the same ones going forward and backward
+		table := NewPieceTable(Sequence(text))
+		forward := []int{0}
+		for position := uint(0); position < table.RuneLength; {
+			position = table.NextGraphemeBoundary(position)
+			forward = append(forward, int(position))
+		}
+		backward := []int{int(table.RuneLength)}
+		for position := table.RuneLength; position > 0; {
+			position = table.PreviousGraphemeBoundary(position)
+			backward = append(backward, int(position))
+		}
+		slices.Reverse(backward)
+		if !slices.Equal(forward, want) || !slices.Equal(backward, want) {
+			t.Errorf("%+q has boundaries %v forward and %v backward, want %v", text, forward, backward, want)
+		}
+	}
+}
+
+func TestGraphemeClusters(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		clusters []string
+	}{
+		{"flags", "🇦🇷🇧🇷", []string{"🇦🇷", "🇧🇷"}},
+		{"a flag and a lone indicator", "🇦🇷🇧", []string{"🇦🇷", "🇧"}},
+		{"a letter between flags", "🇦🇷a🇧🇷", []string{"🇦🇷", "a", "🇧🇷"}},
+		{"zwj family", "👨‍👩‍👧‍👦!", []string{"👨‍👩‍👧‍👦", "!"}},
+		{"zwj with skin tones", "👩🏽‍🤝‍👨🏿", []string{"👩🏽‍🤝‍👨🏿"}},
+		{"zwj after a letter", "a‍👍", []string{"a‍", "👍"}},
+		{"keycap", "1️⃣x", []string{"1️⃣", "x"}},
+		{"combining marks", "é̂o", []string{"é̂", "o"}},
+		{"hangul jamos", "각가", []string{"각", "가"}},
+		{"crlf", "a\r\n\n", []string{"a", "\r\n", "\n"}},
+		{"devanagari conjunct", "क्षत्रिय", []string{"क्ष", "त्रि", "य"}},
+		{"bengali conjunct", "ক্ত", []string{"ক্ত"}},
+		{"zwnj breaks a conjunct", "क्‌ष", []string{"क्‌", "ष"}},
+	}
+	for _, c := range cases {
+		clusters := []string{}
+		var segmenter GraphemeSegmenter
+		for _, char := range c.text {
+			if segmenter.IsBoundary(char) {
+				clusters = append(clusters, "")
+			}
+			clusters[len(clusters)-1] += string(char)
+		}
+		if !slices.Equal(clusters, c.clusters) {
+			t.Errorf("%s: %+q is split as %+q, want %+q", c.name, c.text, clusters, c.clusters)
+		}
+	}
+}
+
+// PreviousGraphemeBoundary only segments MAX_GRAPHEME_LOOKBEHIND runes back
+func TestLongGraphemeCluster(t *testing.T) {
+	cluster := "a" + strings.Repeat("́", MAX_GRAPHEME_LOOKBEHIND-1)
+	table := NewPieceTable(Sequence("x\n" + cluster + "b"))
+	end := uint(2 + MAX_GRAPHEME_LOOKBEHIND)
+	if next := table.NextGraphemeBoundary(2); next != end {
+		t.Fatalf("the cluster ends at %d, want %d", next, end)
+	}
+	if previous := table.PreviousGraphemeBoundary(end); previous != 2 {
+		t.Fatalf("a cluster as long as the lookbehind starts at %d, want 2", previous)
+	}
+
+	// a longer one is found forward, backward the cursor goes back by the lookbehind but never out of it
+	length := 3 * MAX_GRAPHEME_LOOKBEHIND
+	cluster = "a" + strings.Repeat("́", length-1)
+	table = NewPieceTable(Sequence("x\n" + cluster + "b"))
+	end = uint(2 + length)
+	if next := table.NextGraphemeBoundary(2); next != end {
+		t.Fatalf("the long cluster ends at %d, want %d", next, end)
+	}
+	position := end
+	for position > 2 {
+		previous := table.PreviousGraphemeBoundary(position)
+		if previous >= position || previous < 2 || position-previous > MAX_GRAPHEME_LOOKBEHIND {
+			t.Fatalf("the boundary before %d is %d", position, previous)
+		}
+		position = previous
+	}
+	if previous := table.PreviousGraphemeBoundary(2); previous != 1 {
+		t.Fatalf("the boundary before the cluster is %d, want the line break at 1", previous)
+	}
+}
+
+func TestCellWidth(t *testing.T) {
+	cases := []struct {
+		char  rune
+		width int
+	}{
+		{'a', 1},
+		{'é', 1},
+		{'́', 1}, // only a cluster's first char is measured
+		{'ア', 2},
+		{'ｱ', 1}, // halfwidth katakana
+		{'中', 2},
+		{'한', 2},
+		{'Ａ', 2}, // fullwidth latin
+		{'😀', 2},
+		{'⌚', 2},
+		{'☺', 1}, // text presentation by default
+		{'🇦', 2},
+		{'\U00020000', 2},
+		{'α', 1},
+	}
+	for _, c := range cases {
+		if width := CellWidth(c.char); width != c.width {
+			t.Errorf("CellWidth(%+q) is %d, want %d", c.char, width, c.width)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package piecetable
+
+import "fmt"
+
+// Every Insert and Delete records the pieces it replaced and the pieces it left behind.
+// AddBuffer is append-only, so old pieces keep pointing at valid bytes, which means
+// undoing an edit is just putting the old pieces back where they were.
+
+type ChangeType = int
+
+const (
+	INSERT ChangeType = iota
+	DELETE
+)
+
+type Change struct {
+	Type       ChangeType
+	Position   uint // rune position where the edit happened
+	RuneLength uint
+	ByteLength uint
+	PieceIndex int     // index of the first piece touched by the edit
+	Before     []Piece // pieces starting at PieceIndex before the edit
+	After      []Piece // pieces starting at PieceIndex after the edit
+}
+
+// a group of changes that are undone and redone together
+type Transaction struct {
+	ID      int // unique for the History, 0 is never used
+	Changes []Change
+}
+
+type History struct {
+	UndoStack []Transaction
+	RedoStack []Transaction
+	current   *Transaction
+	depth     int // BeginTransaction can be nested, only the outermost EndTransaction commits
+	lastID    int
+	savedID   int // ID of the last transaction applied when the text was saved, 0 when nothing was
+}
+
+// copies the pieces in [start, end) so later in place changes don't affect them
+func (pt *PieceTable) CopyPieces(start int, end int) []Piece {
+	pieces := make([]Piece, 0, end-start)
+	for i := start; i < end; i++ {
+		piece, err := pt.Pieces.GetAt(i)
+		if err != nil {
+			break
+		}
+		pieces = append(pieces, *piece)
+	}
+	return pieces
+}
+
+// replaces length pieces starting at index with copies of pieces.
+// The new ones are inserted first so the collection is never left empty
+func (pt *PieceTable) ReplacePieces(index int, length int, pieces []Piece) error {
+	for i, piece := range pieces {
+		if err := pt.Pieces.InsertAt(&piece, index+i); err != nil {
+			return err
+		}
+	}
+	for range length {
+		if err := pt.Pieces.DeleteAt(index + len(pieces)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pt *PieceTable) Record(change Change) {
+	pt.History.RedoStack = pt.History.RedoStack[:0]
+	if pt.History.current != nil {
+		pt.History.current.Changes = append(pt.History.current.Changes, change)
+		return
+	}
+	pt.History.lastID++
+	pt.History.UndoStack = append(pt.History.UndoStack, Transaction{ID: pt.History.lastID, Changes: []Change{change}})
+}
+
+// Pushes an undo step without changes, for what belongs to the text but isn't in its pieces (like its line ending),
+// the caller keeps what the step changed by its ID. Like CommitTransaction it leaves an open transaction open
+func (pt *PieceTable) RecordStep() int {
+	pt.CommitTransaction()
+	pt.History.RedoStack = pt.History.RedoStack[:0]
+	pt.History.lastID++
+	pt.History.UndoStack = append(pt.History.UndoStack, Transaction{ID: pt.History.lastID})
+	return pt.History.lastID
+}
+
+// every Insert and Delete until the matching EndTransaction is undone as a single step
+func (pt *PieceTable) BeginTransaction() {
+	if pt.History.depth == 0 {
+		pt.History.current = &Transaction{}
+	}
+	pt.History.depth++
+}
+
+func (pt *PieceTable) EndTransaction() {
+	if pt.History.depth == 0 {
+		return
+	}
+	pt.History.depth--
+	if pt.History.depth == 0 {
+		pt.CommitTransaction()
+	}
+}
+
+func (pt *PieceTable) InTransaction() bool {
+	return pt.History.depth > 0
+}
+
+// Pushes the changes of the open transaction as one undo step. When it's committed before its
+// EndTransaction (by Undo, Redo, MarkSaved or a caller that needs its own step) the transaction stays
+// open and the edits after it go in a new step, so the caller's EndTransaction still matches its BeginTransaction
+func (pt *PieceTable) CommitTransaction() {
+	if pt.History.current != nil && len(pt.History.current.Changes) > 0 {
+		pt.History.lastID++
+		pt.History.current.ID = pt.History.lastID
+		pt.History.UndoStack = append(pt.History.UndoStack, *pt.History.current)
+	}
+	pt.History.current = nil
+	if pt.History.depth > 0 {
+		pt.History.current = &Transaction{}
+	}
+}
+
+// ID of the last transaction applied, 0 when the text is the original one
+func (pt *PieceTable) currentID() int {
+	if len(pt.History.UndoStack) == 0 {
+		return 0
+	}
+	return pt.History.UndoStack[len(pt.History.UndoStack)-1].ID
+}
+
+// remembers the current text as the saved one. An open transaction is committed,
+// so edits after the save are never undone together with edits before it
+func (pt *PieceTable) MarkSaved() {
+	pt.CommitTransaction()
+	pt.History.savedID = pt.currentID()
+}
+
+// whether the text differs from the saved one (or the original one if it was never saved).
+// Undoing or redoing back to the saved text makes it unmodified again
+func (pt *PieceTable) IsModified() bool {
+	if pt.History.current != nil && len(pt.History.current.Changes) > 0 {
+		return true
+	}
+	return pt.currentID() != pt.History.savedID
+}
+
+func (pt *PieceTable) CanUndo() bool {
+	return len(pt.History.UndoStack) > 0
+}
+
+func (pt *PieceTable) CanRedo() bool {
+	return len(pt.History.RedoStack) > 0
+}
+
+// reverts the last transaction and returns it, so the caller knows where the cursor should go.
+// The changes of an open transaction are committed first, otherwise they would be left half undone
+func (pt *PieceTable) Undo() (Transaction, error) {
+	pt.CommitTransaction()
+	if !pt.CanUndo() {
+		return Transaction{}, fmt.Errorf("Undo: error trying to undo. UndoStack is empty")
+	}
+	transaction := pt.History.UndoStack[len(pt.History.UndoStack)-1]
+	for i := len(transaction.Changes) - 1; i >= 0; i-- {
+		change := transaction.Changes[i]
+		err := pt.ReplacePieces(change.PieceIndex, len(change.After), change.Before)
+		if err != nil {
+			return Transaction{}, err
+		}
+		pt.applyLengths(change, true)
+	}
+	pt.History.UndoStack = pt.History.UndoStack[:len(pt.History.UndoStack)-1]
+	pt.History.RedoStack = append(pt.History.RedoStack, transaction)
+	return transaction, nil
+}
+
+// applies again the last undone transaction and returns it
+func (pt *PieceTable) Redo() (Transaction, error) {
+	pt.CommitTransaction()
+	if !pt.CanRedo() {
+		return Transaction{}, fmt.Errorf("Redo: error trying to redo. RedoStack is empty")
+	}
+	transaction := pt.History.RedoStack[len(pt.History.RedoStack)-1]
+	for _, change := range transaction.Changes {
+		err := pt.ReplacePieces(change.PieceIndex, len(change.Before), change.After)
+		if err != nil {
+			return Transaction{}, err
+		}
+		pt.applyLengths(change, false)
+	}
+	pt.History.RedoStack = pt.History.RedoStack[:len(pt.History.RedoStack)-1]
+	pt.History.UndoStack = append(pt.History.UndoStack, transaction)
+	return transaction, nil
+}
+
+func (pt *PieceTable) applyLengths(change Change, reverse bool) {
+	grows := change.Type == INSERT
+	if reverse {
+		grows = !grows
+	}
+	if grows {
+		pt.RuneLength += change.RuneLength
+		pt.ByteLength += change.ByteLength
+	} else {
+		pt.RuneLength -= change.RuneLength
+		pt.ByteLength -= change.ByteLength
+	}
+}
@@ -0,0 +1,165 @@
+package piecetable
+
+import (
+	"fmt"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUndoKeepsOuterTransactionOpen(t *testing.T) {
+	table := NewPieceTable(Sequence("abc"))
+	table.BeginTransaction()
+	table.Insert(3, Sequence("d"))
+	table.Insert(4, Sequence("e"))
+	_, err := table.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.ToString() != "abc" {
+		t.Fatalf("undo left %q", table.ToString())
+	}
+	if !table.InTransaction() {
+		t.Fatal("undo closed the caller's transaction")
+	}
+	// the edits after the undo are still grouped until the caller's EndTransaction
+	table.Insert(3, Sequence("x"))
+	table.Insert(4, Sequence("y"))
+	table.EndTransaction()
+	if table.InTransaction() {
+		t.Fatal("EndTransaction didn't close the transaction")
+	}
+	table.Undo()
+	if table.ToString() != "abc" {
+		t.Fatalf("the edits after the undo weren't one step, got %q", table.ToString())
+	}
+	table.Redo()
+	if table.ToString() != "abcxy" {
+		t.Fatalf("redo gave %q", table.ToString())
+	}
+}
+
+func TestNestedTransactions(t *testing.T) {
+	table := NewPieceTable(Sequence(""))
+	table.BeginTransaction()
+	table.Insert(0, Sequence("a"))
+	table.BeginTransaction()
+	table.Insert(1, Sequence("b"))
+	table.EndTransaction()
+	table.Insert(2, Sequence("c"))
+	table.EndTransaction()
+	if len(table.History.UndoStack) != 1 {
+		t.Fatalf("%d undo steps, want 1", len(table.History.UndoStack))
+	}
+	table.Undo()
+	if table.ToString() != "" {
+		t.Fatalf("undo left %q", table.ToString())
+	}
+}
+
+// like the editor does: a typing group and a paste, each in its own transaction, inside a caller's one
+func TestOuterTransactionWrapsTypingAndPaste(t *testing.T) {
+	table := NewPieceTable(Sequence("abc"))
+	table.BeginTransaction()
+	table.BeginTransaction()
+	table.Insert(3, Sequence(" "))
+	table.Insert(4, Sequence("w"))
+	table.Insert(5, Sequence("o"))
+	table.EndTransaction()
+	table.BeginTransaction()
+	table.Insert(6, Sequence("pasted\ntext"))
+	table.EndTransaction()
+	if !table.InTransaction() {
+		t.Fatal("the inner EndTransaction closed the outer transaction")
+	}
+	table.EndTransaction()
+	if len(table.History.UndoStack) != 1 {
+		t.Fatalf("%d undo steps, want 1", len(table.History.UndoStack))
+	}
+	table.Undo()
+	if table.ToString() != "abc" {
+		t.Fatalf("undo left %q", table.ToString())
+	}
+	table.Redo()
+	if table.ToString() != "abc wopasted\ntext" {
+		t.Fatalf("redo gave %q", table.ToString())
+	}
+}
+
+// every edit is one step, undoing and redoing them must give back each text on the way
+func TestUndoRedoRoundTrip(t *testing.T) {
+	edits := []struct {
+		name     string
+		position uint
+		insert   string
+		delete   uint
+	}{
+		{"insert at the start", 0, "» ", 0},
+		{"insert at the end", 13, " ünd", 0},
+		{"insert in the middle", 8, "big ", 0},
+		{"delete inside one piece", 13, "", 2}, // "wörld" becomes "wld"
+		{"delete at the start", 0, "", 2},
+		{"delete at the end", 15, "", 2},
+		{"delete across pieces", 4, "", 6},
+		{"insert inside an inserted piece", 8, "ñ", 0},
+	}
+	for _, collection := range collections {
+		table := NewPieceTable(Sequence("hello wörld"), collection.options...)
+		texts := []string{table.ToString()}
+		for _, edit := range edits {
+			runes := []rune(texts[len(texts)-1])
+			var err error
+			if edit.delete > 0 {
+				err = table.Delete(edit.position, edit.delete)
+				runes = append(runes[:edit.position:edit.position], runes[edit.position+edit.delete:]...)
+			} else {
+				_, err = table.Insert(edit.position, Sequence(edit.insert))
+				runes = append(runes[:edit.position:edit.position], append([]rune(edit.insert), runes[edit.position:]...)...)
+			}
+			if err != nil {
+				t.Fatalf("%s, %s: %v", collection.name, edit.name, err)
+			}
+			texts = append(texts, string(runes))
+			checkText(t, collection.name+", "+edit.name, &table, texts[len(texts)-1])
+		}
+
+		// all the way back, all the way forward, then back and forth in the middle
+		steps := []int{}
+		for i := len(edits) - 1; i >= 0; i-- {
+			steps = append(steps, i)
+		}
+		for i := 1; i <= len(edits); i++ {
+			steps = append(steps, i)
+		}
+		steps = append(steps, 7, 6, 7, 6, 5, 6, 7, 8)
+		current := len(edits)
+		for _, step := range steps {
+			var err error
+			if step < current {
+				_, err = table.Undo()
+			} else {
+				_, err = table.Redo()
+			}
+			if err != nil {
+				t.Fatalf("%s, going to step %d: %v", collection.name, step, err)
+			}
+			current = step
+			checkText(t, fmt.Sprintf("%s, step %d", collection.name, step), &table, texts[step])
+		}
+		if table.CanRedo() {
+			t.Fatalf("%s: there's still something to redo after the last step", collection.name)
+		}
+	}
+}
+
+func checkText(t *testing.T, name string, table *PieceTable, want string) {
+	t.Helper()
+	if got := table.ToString(); got != want {
+		t.Fatalf("%s: the text is %q, want %q", name, got, want)
+	}
+	if table.RuneLength != uint(utf8.RuneCountInString(want)) {
+		t.Fatalf("%s: RuneLength is %d, want %d", name, table.RuneLength, utf8.RuneCountInString(want))
+	}
+	if table.ByteLength != uint(len(want)) {
+		t.Fatalf("%s: ByteLength is %d, want %d", name, table.ByteLength, len(want))
+	}
+}
@@ -0,0 +1,101 @@
+package piecetable
+
+import "bytes"
+
+// The piece table keeps the file's bytes as they are and its lines only break at '\n',
+// so a CRLF is a single line break ending with its LF and any other '\r' is just a char of its line.
+// The only text that is converted is a file whose line breaks are all CR, it's loaded with '\n'
+// and saved with CR again, which gives back the same bytes since it had no '\n' of its own.
+
+type LineEnding = int
+
+const (
+	LF LineEnding = iota
+	CRLF
+	CR
+)
+
+var LINE_ENDING_NAMES = map[LineEnding]string{
+	LF:   "LF",
+	CRLF: "CRLF",
+	CR:   "CR",
+}
+
+func LineEndingSequence(ending LineEnding) Sequence {
+	switch ending {
+	case CRLF:
+		return Sequence("\r\n")
+	case CR:
+		return Sequence("\r")
+	}
+	return Sequence("\n")
+}
+
+// the most used line ending in content, LF when there are none or on ties
+func DetectLineEnding(content Sequence) LineEnding {
+	var lf, crlf, cr int
+	for i := 0; i < len(content); i++ {
+		switch content[i] {
+		case '\n':
+			lf++
+		case '\r':
+			if i+1 < len(content) && content[i+1] == '\n' {
+				crlf++
+				i++
+			} else {
+				cr++
+			}
+		}
+	}
+	if lf >= crlf && lf >= cr {
+		return LF
+	}
+	if crlf >= cr {
+		return CRLF
+	}
+	return CR
+}
+
+// The content the piece table gets for a file and the line ending the file uses.
+// A file that mixes line endings is kept as it is, with the line ending it uses the most
+// (LF when that's CR, since a lone CR doesn't break its line)
+func LoadLineEndings(content Sequence) (Sequence, LineEnding) {
+	ending := DetectLineEnding(content)
+	if ending != CR {
+		return content, ending
+	}
+	if bytes.IndexByte(content, '\n') != -1 {
+		return content, LF
+	}
+	normalized, _ := NormalizeLineEndings(content)
+	return normalized, CR
+}
+
+// replaces every CRLF and CR with LF and returns the line ending the content used.
+// Content without '\r' is returned as it is, without copying
+func NormalizeLineEndings(content Sequence) (Sequence, LineEnding) {
+	ending := DetectLineEnding(content)
+	if bytes.IndexByte(content, '\r') == -1 {
+		return content, ending
+	}
+	normalized := make(Sequence, 0, len(content))
+	for i := 0; i < len(content); i++ {
+		if content[i] != '\r' {
+			normalized = append(normalized, content[i])
+			continue
+		}
+		normalized = append(normalized, '\n')
+		if i+1 < len(content) && content[i+1] == '\n' {
+			i++
+		}
+	}
+	return normalized, ending
+}
+
+// replaces every LF in content with ending
+func ConvertLineEndings(content Sequence, ending LineEnding) Sequence {
+	if ending == LF {
+		return content
+	}
+	return bytes.ReplaceAll(content, []byte{'\n'}, LineEndingSequence(ending))
+}
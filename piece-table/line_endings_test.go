@@ -0,0 +1,86 @@
+package piecetable
+
+import "testing"
+
+func TestLoadLineEndings(t *testing.T) {
+	cases := []struct {
+		content string
+		loaded  string // what the piece table gets
+		ending  LineEnding
+	}{
+		{"", "", LF},
+		{"a\nb\n", "a\nb\n", LF},
+		{"a\r\nb\r\n", "a\r\nb\r\n", CRLF},
+		{"a\rb\r", "a\nb\n", CR},
+		// mixed files are kept as they are, their lone CRs don't break lines
+		{"a\r\nb\nc\r\n", "a\r\nb\nc\r\n", CRLF},
+		{"a\rb\rc\nd", "a\rb\rc\nd", LF},
+		{"a\nb\rc", "a\nb\rc", LF},
+	}
+	for _, c := range cases {
+		loaded, ending := LoadLineEndings(Sequence(c.content))
+		if string(loaded) != c.loaded || ending != c.ending {
+			t.Errorf("LoadLineEndings(%q) is %q and %s, want %q and %s", c.content, loaded, LINE_ENDING_NAMES[ending], c.loaded, LINE_ENDING_NAMES[c.ending])
+		}
+		// saving gives back the file's bytes
+		saved := loaded
+		if ending == CR {
+			saved = ConvertLineEndings(loaded, CR)
+		}
+		if string(saved) != c.content {
+			t.Errorf("%q is saved as %q", c.content, saved)
+		}
+	}
+}
+
+func TestCRLFLines(t *testing.T) {
+	for _, collection := range collections {
+		table := NewPieceTable(Sequence("ab\r\ncd\r\n\r\ne\rf"), collection.options...)
+		if table.LineCount() != 4 {
+			t.Fatalf("%s: LineCount is %d, want 4", collection.name, table.LineCount())
+		}
+		for line, want := range []uint{2, 6, 8, 13} {
+			end, err := table.LineEnd(line)
+			if err != nil || end != want {
+				t.Errorf("%s: LineEnd(%d) is %d, want %d (%v)", collection.name, line, end, want, err)
+			}
+		}
+		// a CRLF is a single cluster, the cursor never stops inside it
+		if next := table.NextGraphemeBoundary(2); next != 4 {
+			t.Errorf("%s: the cluster at 2 ends at %d, want 4", collection.name, next)
+		}
+		if previous := table.PreviousGraphemeBoundary(4); previous != 2 {
+			t.Errorf("%s: the cluster before 4 starts at %d, want 2", collection.name, previous)
+		}
+	}
+}
+
+func TestCRLFWords(t *testing.T) {
+	table := NewPieceTable(Sequence("ab  \r\ncd\r\n\r\nef"))
+	forward := []struct{ from, to uint }{
+		{0, 2},   // the word
+		{2, 4},   // the spaces stop before the CRLF
+		{4, 6},   // the CRLF
+		{6, 8},   // cd
+		{8, 10},  // the CRLF
+		{10, 12}, // the empty line's CRLF
+	}
+	for _, c := range forward {
+		if end := table.NextWordEnd(c.from); end != c.to {
+			t.Errorf("NextWordEnd(%d) is %d, want %d", c.from, end, c.to)
+		}
+	}
+	backward := []struct{ from, to uint }{
+		{14, 12},
+		{12, 10},
+		{10, 8},
+		{8, 6},
+		{6, 4},
+		{4, 0}, // the spaces are skipped with the word before them
+	}
+	for _, c := range backward {
+		if start := table.PreviousWordStart(c.from); start != c.to {
+			t.Errorf("PreviousWordStart(%d) is %d, want %d", c.from, start, c.to)
+		}
+	}
+}
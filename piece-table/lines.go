@@ -0,0 +1,179 @@
+package piecetable
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Both buffers keep the rune offsets of their line breaks. Since the buffers never change
+// (AddBuffer only grows), counting the line breaks of any piece is just two binary searches,
+// and every piece keeps its count in LineBreaks so lines can be found without reading the text.
+
+// Collections that can find pieces by line break, like PieceTree with its subtree counts
+type LineIndexed interface {
+	FindByLineBreak(lineBreak uint) (int, *Piece, uint, uint, bool)
+	LineBreaksBefore(index int) uint
+}
+
+func LineBreakOffsets(sequence Sequence, runeStart uint) []uint {
+	offsets := make([]uint, 0)
+	for i, char := range sequence.RuneForward() {
+		if char == '\n' {
+			offsets = append(offsets, runeStart+uint(i))
+		}
+	}
+	return offsets
+}
+
+func (pt *PieceTable) bufferLineBreaks(piece *Piece) []uint {
+	if piece.isOriginal {
+		return pt.OriginalLineBreaks
+	}
+	return pt.AddLineBreaks
+}
+
+// line breaks in [runeStart, runeEnd) of the piece's buffer
+func (pt *PieceTable) CountLineBreaks(piece *Piece, runeStart uint, runeEnd uint) uint {
+	lineBreaks := pt.bufferLineBreaks(piece)
+	start, _ := slices.BinarySearch(lineBreaks, runeStart)
+	end, _ := slices.BinarySearch(lineBreaks, runeEnd)
+	return uint(end - start)
+}
+
+func (pt *PieceTable) PieceLineBreaks(piece *Piece) uint {
+	return pt.CountLineBreaks(piece, piece.RuneStart, piece.RuneStart+piece.RuneLength)
+}
+
+func (pt *PieceTable) LineBreaks() uint {
+	if indexed, ok := pt.Pieces.(LineIndexed); ok {
+		return indexed.LineBreaksBefore(pt.Pieces.Size())
+	}
+	var lineBreaks uint
+	for _, piece := range pt.Pieces.Forward() {
+		lineBreaks += piece.LineBreaks
+	}
+	return lineBreaks
+}
+
+func (pt *PieceTable) LineCount() int {
+	return int(pt.LineBreaks()) + 1
+}
+
+// rune position where line starts, lines start at 0
+func (pt *PieceTable) LineStart(line int) (uint, error) {
+	if line < 0 || line >= pt.LineCount() {
+		return 0, fmt.Errorf("LineStart: error trying to find line start. line >= LineCount")
+	}
+	if line == 0 {
+		return 0, nil
+	}
+
+	// line n starts right after the nth line break
+	lineBreak := uint(line)
+	var piece *Piece
+	var runeStartPosition, lineBreaksBefore uint
+	if indexed, ok := pt.Pieces.(LineIndexed); ok {
+		var found bool
+		_, piece, runeStartPosition, lineBreaksBefore, found = indexed.FindByLineBreak(lineBreak)
+		if !found {
+			return 0, fmt.Errorf("LineStart: error trying to find line break %d", lineBreak)
+		}
+	} else {
+		for _, p := range pt.Pieces.Forward() {
+			if lineBreaksBefore+p.LineBreaks >= lineBreak {
+				piece = p
+				break
+			}
+			lineBreaksBefore += p.LineBreaks
+			runeStartPosition += p.RuneLength
+		}
+		if piece == nil {
+			return 0, fmt.Errorf("LineStart: error trying to find line break %d", lineBreak)
+		}
+	}
+
+	lineBreaks := pt.bufferLineBreaks(piece)
+	first, _ := slices.BinarySearch(lineBreaks, piece.RuneStart)
+	offset := lineBreaks[first+int(lineBreak-lineBreaksBefore)-1]
+	return runeStartPosition + (offset - piece.RuneStart) + 1, nil
+}
+
+// rune position where line's content ends, before its line break (both runes of a CRLF)
+func (pt *PieceTable) LineEnd(line int) (uint, error) {
+	if line < 0 || line >= pt.LineCount() {
+		return 0, fmt.Errorf("LineEnd: error trying to find line end. line >= LineCount")
+	}
+	if line+1 == pt.LineCount() {
+		return pt.RuneLength, nil
+	}
+	next, err := pt.LineStart(line + 1)
+	if err != nil {
+		return 0, err
+	}
+	end := next - 1
+	if end > 0 {
+		if char, err := pt.GetAt(end - 1); err == nil && char == '\r' {
+			end--
+		}
+	}
+	return end, nil
+}
+
+// line of the rune at offset, offset can be RuneLength to get the last line
+func (pt *PieceTable) LineOfOffset(offset uint) (int, error) {
+	if offset > pt.RuneLength {
+		return 0, fmt.Errorf("LineOfOffset: error trying to find line of offset > RuneLength")
+	}
+	if offset == pt.RuneLength {
+		return int(pt.LineBreaks()), nil
+	}
+
+	var piece *Piece
+	var runeStartPosition, lineBreaksBefore uint
+	indexed, isLineIndexed := pt.Pieces.(LineIndexed)
+	positionIndexed, isPositionIndexed := pt.Pieces.(PositionIndexed)
+	if isLineIndexed && isPositionIndexed {
+		var index int
+		var found bool
+		index, piece, runeStartPosition, _, found = positionIndexed.FindByRunePosition(offset, false)
+		if !found {
+			return 0, fmt.Errorf("LineOfOffset: error trying to find piece at offset %d", offset)
+		}
+		lineBreaksBefore = indexed.LineBreaksBefore(index)
+	} else {
+		for _, p := range pt.Pieces.Forward() {
+			if runeStartPosition+p.RuneLength > offset {
+				piece = p
+				break
+			}
+			lineBreaksBefore += p.LineBreaks
+			runeStartPosition += p.RuneLength
+		}
+		if piece == nil {
+			return 0, fmt.Errorf("LineOfOffset: error trying to find piece at offset %d", offset)
+		}
+	}
+
+	lineBreaksInPiece := pt.CountLineBreaks(piece, piece.RuneStart, piece.RuneStart+(offset-runeStartPosition))
+	return int(lineBreaksBefore + lineBreaksInPiece), nil
+}
+
+// line's content including its line break, lines start at 0
+func (pt *PieceTable) Line(line int) (Sequence, error) {
+	start, err := pt.LineStart(line)
+	if err != nil {
+		return Sequence{}, err
+	}
+	end := pt.RuneLength
+	if line+1 < pt.LineCount() {
+		end, err = pt.LineStart(line + 1)
+		if err != nil {
+			return Sequence{}, err
+		}
+	}
+	if start == end {
+		return Sequence{}, nil
+	}
+	sequence, _, err := pt.GetSequence(start, end-start)
+	return sequence, err
+}
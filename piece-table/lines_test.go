@@ -0,0 +1,126 @@
+package piecetable
+
+import (
+	"strings"
+	"testing"
+)
+
+var collections = []struct {
+	name    string
+	options []Option
+}{
+	{"LinkedList", nil},
+	{"PieceTree", []Option{WithPieceTree()}},
+}
+
+// checks the line index against the lines of text, and every piece's LineBreaks against its own text
+func checkLines(t *testing.T, table *PieceTable, text string) {
+	t.Helper()
+	if table.ToString() != text {
+		t.Fatalf("the table has %q, want %q", table.ToString(), text)
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if table.LineCount() != len(lines) {
+		t.Fatalf("LineCount is %d, want %d", table.LineCount(), len(lines))
+	}
+	var start uint
+	for i, line := range lines {
+		lineStart, err := table.LineStart(i)
+		if err != nil || lineStart != start {
+			t.Fatalf("LineStart(%d) is %d, want %d (%v)", i, lineStart, start, err)
+		}
+		content, err := table.Line(i)
+		if err != nil || string(content) != line {
+			t.Fatalf("Line(%d) is %q, want %q (%v)", i, content, line, err)
+		}
+		length := uint(len([]rune(line)))
+		for offset := start; offset < start+length; offset++ {
+			lineOfOffset, err := table.LineOfOffset(offset)
+			if err != nil || lineOfOffset != i {
+				t.Fatalf("LineOfOffset(%d) is %d, want %d (%v)", offset, lineOfOffset, i, err)
+			}
+		}
+		start += length
+	}
+	last, err := table.LineOfOffset(table.RuneLength)
+	if err != nil || last != len(lines)-1 {
+		t.Fatalf("LineOfOffset(RuneLength) is %d, want %d (%v)", last, len(lines)-1, err)
+	}
+	if _, err := table.LineStart(len(lines)); err == nil {
+		t.Fatal("LineStart after the last line didn't fail")
+	}
+	if _, err := table.LineOfOffset(table.RuneLength + 1); err == nil {
+		t.Fatal("LineOfOffset after the end didn't fail")
+	}
+	for i, piece := range table.Pieces.Forward() {
+		content := table.PieceSequence(piece, piece.ByteStart, piece.ByteStart+piece.ByteLength)
+		if want := uint(strings.Count(string(content), "\n")); piece.LineBreaks != want {
+			t.Fatalf("piece %d (%q) has %d LineBreaks, want %d", i, content, piece.LineBreaks, want)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	texts := []string{
+		"",
+		"\n",
+		"one line",
+		"ends with a break\n",
+		"two\nlines",
+		"two\nlines\n",
+		"\n\nempty\n\n",
+		"wörld\nçé\n",
+	}
+	for _, collection := range collections {
+		for _, text := range texts {
+			t.Run(collection.name, func(t *testing.T) {
+				table := NewPieceTable(Sequence(text), collection.options...)
+				checkLines(t, &table, text)
+			})
+		}
+	}
+}
+
+func TestLinesAfterEdits(t *testing.T) {
+	type edit struct {
+		insert   bool
+		position uint
+		text     string // inserted text, or the deleted one so its length is known
+	}
+	cases := []struct {
+		name     string
+		original string
+		edits    []edit
+		want     string
+	}{
+		{"insert a break splitting a piece", "abcdef", []edit{{true, 3, "\n"}}, "abc\ndef"},
+		{"split a piece right before its break", "ab\ncd\n", []edit{{true, 2, "x"}}, "abx\ncd\n"},
+		{"split a piece right after its break", "ab\ncd\n", []edit{{true, 3, "x"}}, "ab\nxcd\n"},
+		{"insert after the final break", "ab\n", []edit{{true, 3, "c"}}, "ab\nc"},
+		{"insert into empty text", "", []edit{{true, 0, "a\nb"}}, "a\nb"},
+		{"delete a break", "ab\ncd", []edit{{false, 2, "\n"}}, "abcd"},
+		{"delete the final break", "ab\ncd\n", []edit{{false, 5, "\n"}}, "ab\ncd"},
+		{"delete across pieces", "ab\ncd\nef", []edit{{true, 4, "x\ny"}, {false, 1, "b\ncx\n"}}, "ayd\nef"},
+		{"delete everything", "ab\ncd\n", []edit{{false, 0, "ab\ncd\n"}}, ""},
+		{"break inside an inserted piece", "ab\ncd", []edit{{true, 1, "1\n2\n3"}, {true, 4, "\n"}}, "a1\n2\n\n3b\ncd"},
+	}
+	for _, collection := range collections {
+		for _, c := range cases {
+			t.Run(collection.name+"/"+c.name, func(t *testing.T) {
+				table := NewPieceTable(Sequence(c.original), collection.options...)
+				for _, e := range c.edits {
+					if e.insert {
+						table.Insert(e.position, Sequence(e.text))
+					} else {
+						table.Delete(e.position, uint(len([]rune(e.text))))
+					}
+				}
+				checkLines(t, &table, c.want)
+				for range c.edits {
+					table.Undo()
+				}
+				checkLines(t, &table, c.original)
+			})
+		}
+	}
+}
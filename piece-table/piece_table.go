@@ -25,6 +25,17 @@ type Collection[T any] interface {
 	Backward() iter.Seq2[int, T]
 }
 
+// Collections that keep something about their values, like PieceTree's subtree lengths,
+// need to be told when a value is changed in place
+type Updatable interface {
+	Update(index int) error
+}
+
+// Collections that can find a piece by rune position without walking through every piece
+type PositionIndexed interface {
+	FindByRunePosition(position uint, inclusive bool) (int, *Piece, uint, uint, bool)
+}
+
 // ---------------------------------------------------
 // Golang implementation of piece table datastructure
 // ---------------------------------------------------
@@ -34,6 +45,7 @@ type Piece struct {
 	RuneStart  uint
 	ByteLength uint
 	RuneLength uint
+	LineBreaks uint
 	isOriginal bool
 }
 
@@ -98,26 +110,51 @@ type PieceTable struct {
 	Pieces              Collection[*Piece]
 	ByteLength          uint
 	RuneLength          uint
+	OriginalLineBreaks  []uint // rune offsets of every line break in OriginalBuffer
+	AddLineBreaks       []uint // rune offsets of every line break in AddBuffer
+	History             History
 }
 
-func NewPieceTable(content Sequence) PieceTable {
+type Option func(pt *PieceTable)
+
+// Stores the pieces in a PieceTree instead of a LinkedList,
+// so finding, inserting and deleting pieces doesn't get slower as the edits pile up
+func WithPieceTree() Option {
+	return func(pt *PieceTable) {
+		tree := NewPieceTree()
+		for _, piece := range pt.Pieces.Forward() {
+			tree.Append(piece)
+		}
+		pt.Pieces = &tree
+	}
+}
+
+func NewPieceTable(content Sequence, options ...Option) PieceTable {
 	runeLength := utf8.RuneCount(content)
+	lineBreaks := LineBreakOffsets(content, 0)
 	ll := NewLinkedList(&Piece{
 		ByteStart:  0,
 		RuneStart:  0,
 		ByteLength: uint(len(content)),
 		RuneLength: uint(runeLength),
+		LineBreaks: uint(len(lineBreaks)),
 		isOriginal: true,
 	},
 	)
 
-	return PieceTable{
-		OriginalBuffer: content,
-		AddBuffer:      Sequence{},
-		Pieces:         &ll,
-		ByteLength:     uint(len(content)),
-		RuneLength:     uint(runeLength),
+	pt := PieceTable{
+		OriginalBuffer:     content,
+		AddBuffer:          Sequence{},
+		Pieces:             &ll,
+		ByteLength:         uint(len(content)),
+		RuneLength:         uint(runeLength),
+		OriginalLineBreaks: lineBreaks,
+		AddLineBreaks:      []uint{},
+	}
+	for _, option := range options {
+		option(&pt)
 	}
+	return pt
 }
 
 func (pt *PieceTable) PieceSequence(piece *Piece, start uint, end uint) Sequence {
@@ -178,7 +215,12 @@ func (pt *PieceTable) GetBytePosition(pieces []*Piece, position uint, runeStartP
 
 // treat as byte
 func (pt *PieceTable) ToString() string {
-	sequence := Sequence{}
+	return string(pt.Bytes())
+}
+
+// the whole text, byte by byte as it is in the buffers
+func (pt *PieceTable) Bytes() Sequence {
+	sequence := make(Sequence, 0, pt.ByteLength)
 	for _, piece := range pt.Pieces.Forward() {
 		start, length := piece.ByteStart, piece.ByteStart+piece.ByteLength
 		if piece.isOriginal {
@@ -188,7 +230,7 @@ func (pt *PieceTable) ToString() string {
 			sequence = append(sequence, pt.AddBuffer[start:length]...)
 		}
 	}
-	return string(sequence)
+	return sequence
 }
 
 func (pt *PieceTable) PiecesAmount() uint {
@@ -267,8 +309,31 @@ func (pt *PieceTable) FindPiece(position uint) (FoundPieces, error) {
 	}
 
 	fp := FoundPieces{}
-	startFromBeginning := position < pt.RuneLength/2
-	if startFromBeginning {
+	// position 0 always goes forward, searching backward would never find a piece starting before it
+	startFromBeginning := position == 0 || position < pt.RuneLength/2
+	if indexed, ok := pt.Pieces.(PositionIndexed); ok {
+		i, piece, runeStart, byteStart, found := indexed.FindByRunePosition(position, true)
+		if !found {
+			return FoundPieces{}, nil
+		}
+		fp.RuneStartPosition = runeStart
+		fp.ByteStartPosition = byteStart
+		fp.RuneEndPosition = runeStart + piece.RuneLength
+		fp.ByteEndPosition = byteStart + piece.ByteLength
+		var byteIndex uint
+		fp.BytePosition, byteIndex = pt.GetBytePosition(
+			[]*Piece{piece},
+			position,
+			fp.RuneStartPosition,
+			fp.ByteStartPosition,
+		)
+		sequence := pt.PieceSequence(piece, piece.ByteStart, piece.ByteStart+piece.ByteLength)
+		_, size := utf8.DecodeRune(sequence[byteIndex:])
+		fp.ByteLength = uint(size)
+		fp.Pieces = []*Piece{piece}
+		fp.FirstPieceIndex = i
+		return fp, nil
+	} else if startFromBeginning {
 		for i, piece := range pt.Pieces.Forward() {
 			fp.RuneEndPosition += piece.RuneLength
 			fp.ByteEndPosition += piece.ByteLength
@@ -353,7 +418,49 @@ func (pt *PieceTable) FindPieces(position uint, length uint) (FoundPieces, error
 
 	fp := FoundPieces{}
 	var startFromBeginning bool = position < pt.RuneLength/2
-	if startFromBeginning {
+	if indexed, ok := pt.Pieces.(PositionIndexed); ok {
+		// the first piece is the one holding the rune at position and
+		// the last one is the one holding the rune before position+length
+		firstIndex, _, runeStart, byteStart, found := indexed.FindByRunePosition(position, false)
+		if !found {
+			return FoundPieces{}, nil
+		}
+		lastIndex := firstIndex
+		if length > 0 {
+			i, _, _, _, found := indexed.FindByRunePosition(position+length, true)
+			if !found {
+				i = pt.Pieces.Size() - 1
+			}
+			lastIndex = max(lastIndex, i)
+		}
+		fp.FirstPieceIndex = firstIndex
+		fp.RuneStartPosition = runeStart
+		fp.ByteStartPosition = byteStart
+		fp.RuneEndPosition = runeStart
+		fp.ByteEndPosition = byteStart
+		for i := firstIndex; i <= lastIndex; i++ {
+			piece, err := pt.Pieces.GetAt(i)
+			if err != nil {
+				return FoundPieces{}, err
+			}
+			fp.Pieces = append(fp.Pieces, piece)
+			fp.RuneEndPosition += piece.RuneLength
+			fp.ByteEndPosition += piece.ByteLength
+		}
+		fp.BytePosition, _ = pt.GetBytePosition(
+			fp.Pieces,
+			position,
+			fp.RuneStartPosition,
+			fp.ByteStartPosition,
+		)
+		byteEnd, _ := pt.GetBytePosition(
+			fp.Pieces,
+			position+length,
+			fp.RuneStartPosition,
+			fp.ByteStartPosition,
+		)
+		fp.ByteLength = byteEnd - fp.BytePosition
+	} else if startFromBeginning {
 		var runeEndPositionBeforeSwitchPiece uint
 		var byteEndPositionBeforeSwitchPiece uint
 		for i, piece := range pt.Pieces.Forward() {
@@ -441,11 +548,21 @@ func (pt *PieceTable) Insert(position uint, text Sequence) (uint, error) {
 	}
 
 	foundPiecesMetadata, err := pt.FindPiece(position)
-	foundPiece := foundPiecesMetadata.Pieces[0]
 	if err != nil {
 		return 0, err
 	}
+	foundPiece := foundPiecesMetadata.Pieces[0]
+
+	// appending may skip empty pieces at the end, so every piece after foundPiece is recorded
+	pieceIndex := foundPiecesMetadata.FirstPieceIndex
+	piecesTouched := 1
+	if position == pt.RuneLength {
+		piecesTouched = pt.Pieces.Size() - pieceIndex
+	}
+	piecesAmountBefore := pt.Pieces.Size()
+	before := pt.CopyPieces(pieceIndex, pieceIndex+piecesTouched)
 	pt.AddBuffer = append(pt.AddBuffer, text...)
+	pt.AddLineBreaks = append(pt.AddLineBreaks, LineBreakOffsets(text, runeStart)...)
 
 	piece := &Piece{
 		ByteStart:  byteStart,
@@ -519,11 +636,38 @@ func (pt *PieceTable) Insert(position uint, text Sequence) (uint, error) {
 	pt.ByteLength += byteLength
 	pt.RuneLength += runeLength
 	pt.AddBufferRuneLength += runeLength
+	pt.UpdatePieces(pieceIndex, pieceIndex+piecesTouched+pt.Pieces.Size()-piecesAmountBefore)
+	pt.Record(Change{
+		Type:       INSERT,
+		Position:   position,
+		RuneLength: runeLength,
+		ByteLength: byteLength,
+		PieceIndex: pieceIndex,
+		Before:     before,
+		After:      pt.CopyPieces(pieceIndex, pieceIndex+piecesTouched+pt.Pieces.Size()-piecesAmountBefore),
+	})
 	return runeLength, nil
 }
 
+// pieces are changed in place by Insert and Delete, so their line breaks are counted again
+// and collections that keep their lengths around need to recalculate them
+func (pt *PieceTable) UpdatePieces(start int, end int) {
+	updatable, ok := pt.Pieces.(Updatable)
+	for i := start; i < end; i++ {
+		piece, err := pt.Pieces.GetAt(i)
+		if err != nil {
+			return
+		}
+		piece.LineBreaks = pt.PieceLineBreaks(piece)
+		if ok {
+			updatable.Update(i)
+		}
+	}
+}
+
+// the last piece is kept even when empty, so there's always a piece to insert into
 func (pt *PieceTable) DeleteIfEmpty(piece *Piece, index int) bool {
-	if piece.ByteLength <= 0 {
+	if piece.ByteLength <= 0 && pt.Pieces.Size() > 1 {
 		pt.Pieces.DeleteAt(index)
 		return true
 	}
@@ -549,19 +693,24 @@ func (pt *PieceTable) Delete(position uint, length uint) error {
 		return err
 	}
 
+	pieceIndex := foundPiecesMetadata.FirstPieceIndex
+	piecesTouched := len(foundPiecesMetadata.Pieces)
+	piecesAmountBefore := pt.Pieces.Size()
+	before := pt.CopyPieces(pieceIndex, pieceIndex+piecesTouched)
+
 	if len(foundPiecesMetadata.Pieces) == 1 {
 		piece := foundPiecesMetadata.Pieces[0]
 		deletionInTheMiddle := position != foundPiecesMetadata.RuneStartPosition && position+length != foundPiecesMetadata.RuneEndPosition
 		if deletionInTheMiddle {
 			piece.RuneLength = position - foundPiecesMetadata.RuneStartPosition
 			piece.ByteLength = foundPiecesMetadata.BytePosition - foundPiecesMetadata.ByteStartPosition
-			runeNewPieceStart := piece.RuneStart + length + (position - foundPiecesMetadata.RuneStartPosition)
-			byteNewPieceStart := piece.ByteStart + foundPiecesMetadata.ByteLength + (position - foundPiecesMetadata.ByteStartPosition)
+			runeNewPieceStart := piece.RuneStart + piece.RuneLength + length
+			byteNewPieceStart := piece.ByteStart + piece.ByteLength + foundPiecesMetadata.ByteLength
 			newPiece := &Piece{
 				RuneStart:  runeNewPieceStart,
 				ByteStart:  byteNewPieceStart,
-				RuneLength: foundPiecesMetadata.RuneEndPosition - (position + 1),
-				ByteLength: foundPiecesMetadata.ByteEndPosition - (position + foundPiecesMetadata.ByteLength),
+				RuneLength: foundPiecesMetadata.RuneEndPosition - (position + length),
+				ByteLength: foundPiecesMetadata.ByteEndPosition - (foundPiecesMetadata.BytePosition + foundPiecesMetadata.ByteLength),
 				isOriginal: piece.isOriginal,
 			}
 			pt.Pieces.InsertAt(newPiece, foundPiecesMetadata.FirstPieceIndex+1)
@@ -609,6 +758,16 @@ func (pt *PieceTable) Delete(position uint, length uint) error {
 
 	pt.RuneLength -= length
 	pt.ByteLength -= foundPiecesMetadata.ByteLength
+	pt.UpdatePieces(pieceIndex, pieceIndex+piecesTouched+pt.Pieces.Size()-piecesAmountBefore)
+	pt.Record(Change{
+		Type:       DELETE,
+		Position:   position,
+		RuneLength: length,
+		ByteLength: foundPiecesMetadata.ByteLength,
+		PieceIndex: pieceIndex,
+		Before:     before,
+		After:      pt.CopyPieces(pieceIndex, pieceIndex+piecesTouched+pt.Pieces.Size()-piecesAmountBefore),
+	})
 	return nil
 }
 
@@ -0,0 +1,411 @@
+package piecetable
+
+import (
+	"fmt"
+	"iter"
+)
+
+// ---------------------------------------------------------------------------
+// Left-leaning red-black tree keyed by index (the pieces order), where every
+// node also knows the amount of pieces, runes, bytes and line breaks below it.
+// That way finding a piece by rune position, inserting and deleting are all
+// O(log n) instead of walking the whole linked list.
+// ---------------------------------------------------------------------------
+
+type TreeNode struct {
+	Value      *Piece
+	Left       *TreeNode
+	Right      *TreeNode
+	red        bool
+	size       int  // pieces in this subtree
+	runeLength uint // runes in this subtree
+	byteLength uint // bytes in this subtree
+	lineBreaks uint // line breaks in this subtree
+}
+
+type PieceTree struct {
+	Root *TreeNode
+}
+
+func NewPieceTree(values ...*Piece) PieceTree {
+	tree := PieceTree{}
+	for _, value := range values {
+		tree.Append(value)
+	}
+	return tree
+}
+
+func newTreeNode(value *Piece) *TreeNode {
+	node := &TreeNode{Value: value, red: true}
+	node.update()
+	return node
+}
+
+func (n *TreeNode) Size() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *TreeNode) RuneLength() uint {
+	if n == nil {
+		return 0
+	}
+	return n.runeLength
+}
+
+func (n *TreeNode) ByteLength() uint {
+	if n == nil {
+		return 0
+	}
+	return n.byteLength
+}
+
+func (n *TreeNode) LineBreaks() uint {
+	if n == nil {
+		return 0
+	}
+	return n.lineBreaks
+}
+
+func (n *TreeNode) update() {
+	n.size = n.Left.Size() + n.Right.Size() + 1
+	n.runeLength = n.Left.RuneLength() + n.Right.RuneLength() + n.Value.RuneLength
+	n.byteLength = n.Left.ByteLength() + n.Right.ByteLength() + n.Value.ByteLength
+	n.lineBreaks = n.Left.LineBreaks() + n.Right.LineBreaks() + n.Value.LineBreaks
+}
+
+func isRed(n *TreeNode) bool {
+	return n != nil && n.red
+}
+
+func rotateLeft(h *TreeNode) *TreeNode {
+	x := h.Right
+	h.Right = x.Left
+	x.Left = h
+	x.red = h.red
+	h.red = true
+	h.update()
+	x.update()
+	return x
+}
+
+func rotateRight(h *TreeNode) *TreeNode {
+	x := h.Left
+	h.Left = x.Right
+	x.Right = h
+	x.red = h.red
+	h.red = true
+	h.update()
+	x.update()
+	return x
+}
+
+func flipColors(h *TreeNode) {
+	h.red = !h.red
+	h.Left.red = !h.Left.red
+	h.Right.red = !h.Right.red
+}
+
+func balance(h *TreeNode) *TreeNode {
+	if isRed(h.Right) && !isRed(h.Left) {
+		h = rotateLeft(h)
+	}
+	if isRed(h.Left) && isRed(h.Left.Left) {
+		h = rotateRight(h)
+	}
+	if isRed(h.Left) && isRed(h.Right) {
+		flipColors(h)
+	}
+	h.update()
+	return h
+}
+
+func moveRedLeft(h *TreeNode) *TreeNode {
+	flipColors(h)
+	if isRed(h.Right.Left) {
+		h.Right = rotateRight(h.Right)
+		h = rotateLeft(h)
+		flipColors(h)
+	}
+	return h
+}
+
+func moveRedRight(h *TreeNode) *TreeNode {
+	flipColors(h)
+	if isRed(h.Left.Left) {
+		h = rotateRight(h)
+		flipColors(h)
+	}
+	return h
+}
+
+func (t *PieceTree) Size() int {
+	return t.Root.Size()
+}
+
+func (t *PieceTree) Append(value *Piece) {
+	t.InsertAt(value, t.Size())
+}
+
+func (t *PieceTree) Pop() {
+	t.DeleteAt(t.Size() - 1)
+}
+
+func (t *PieceTree) InsertAt(value *Piece, index int) error {
+	if index < 0 || index > t.Size() {
+		return fmt.Errorf("InsertAt: error trying to insert. index > Size")
+	}
+	t.Root = insertNode(t.Root, value, index)
+	t.Root.red = false
+	return nil
+}
+
+// index is relative to h's subtree
+func insertNode(h *TreeNode, value *Piece, index int) *TreeNode {
+	if h == nil {
+		return newTreeNode(value)
+	}
+	if index <= h.Left.Size() {
+		h.Left = insertNode(h.Left, value, index)
+	} else {
+		h.Right = insertNode(h.Right, value, index-h.Left.Size()-1)
+	}
+	return balance(h)
+}
+
+func (t *PieceTree) DeleteAt(index int) error {
+	if index < 0 || index >= t.Size() {
+		return fmt.Errorf("DeleteAt: error trying to delete. index >= Size")
+	}
+	if !isRed(t.Root.Left) && !isRed(t.Root.Right) {
+		t.Root.red = true
+	}
+	t.Root = deleteNode(t.Root, index)
+	if t.Root != nil {
+		t.Root.red = false
+	}
+	return nil
+}
+
+// rotations don't change the order of the pieces, so index stays valid
+// as long as it's compared against the current left subtree size
+func deleteNode(h *TreeNode, index int) *TreeNode {
+	if index < h.Left.Size() {
+		if !isRed(h.Left) && !isRed(h.Left.Left) {
+			h = moveRedLeft(h)
+		}
+		h.Left = deleteNode(h.Left, index)
+	} else {
+		if isRed(h.Left) {
+			h = rotateRight(h)
+		}
+		if index == h.Left.Size() && h.Right == nil {
+			return nil
+		}
+		if !isRed(h.Right) && !isRed(h.Right.Left) {
+			h = moveRedRight(h)
+		}
+		if index == h.Left.Size() {
+			h.Value = minNode(h.Right).Value
+			h.Right = deleteMinNode(h.Right)
+		} else {
+			h.Right = deleteNode(h.Right, index-h.Left.Size()-1)
+		}
+	}
+	return balance(h)
+}
+
+func minNode(h *TreeNode) *TreeNode {
+	for h.Left != nil {
+		h = h.Left
+	}
+	return h
+}
+
+func deleteMinNode(h *TreeNode) *TreeNode {
+	if h.Left == nil {
+		return nil
+	}
+	if !isRed(h.Left) && !isRed(h.Left.Left) {
+		h = moveRedLeft(h)
+	}
+	h.Left = deleteMinNode(h.Left)
+	return balance(h)
+}
+
+func (t *PieceTree) GetNodeAt(index int) (*TreeNode, error) {
+	if index < 0 || index >= t.Size() {
+		return nil, fmt.Errorf("GetNodeAt: error trying to get node. index >= Size")
+	}
+	node := t.Root
+	for node != nil {
+		leftSize := node.Left.Size()
+		if index < leftSize {
+			node = node.Left
+		} else if index == leftSize {
+			break
+		} else {
+			index -= leftSize + 1
+			node = node.Right
+		}
+	}
+	return node, nil
+}
+
+func (t *PieceTree) GetAt(index int) (*Piece, error) {
+	node, err := t.GetNodeAt(index)
+	if err != nil {
+		return nil, err
+	}
+	return node.Value, nil
+}
+
+// recalculates the subtree lengths above the piece at index,
+// it must be called after a piece is changed in place
+func (t *PieceTree) Update(index int) error {
+	if index < 0 || index >= t.Size() {
+		return fmt.Errorf("Update: error trying to update. index >= Size")
+	}
+	updateNode(t.Root, index)
+	return nil
+}
+
+func updateNode(h *TreeNode, index int) {
+	leftSize := h.Left.Size()
+	if index < leftSize {
+		updateNode(h.Left, index)
+	} else if index > leftSize {
+		updateNode(h.Right, index-leftSize-1)
+	}
+	h.update()
+}
+
+// Finds the first piece whose end is after position, or at position when inclusive is true.
+// It's the same rule FindPiece (inclusive) and FindPieces (exclusive) use when walking forward.
+//
+// Returns index, piece, runeStartPosition, byteStartPosition, found
+func (t *PieceTree) FindByRunePosition(position uint, inclusive bool) (int, *Piece, uint, uint, bool) {
+	passes := func(length uint, position uint) bool {
+		if inclusive {
+			return length >= position
+		}
+		return length > position
+	}
+	if !passes(t.Root.RuneLength(), position) {
+		return -1, nil, 0, 0, false
+	}
+	var index int
+	var runeStart, byteStart uint
+	node := t.Root
+	for node != nil {
+		if node.Left != nil && passes(node.Left.RuneLength(), position) {
+			node = node.Left
+			continue
+		}
+		position -= node.Left.RuneLength()
+		index += node.Left.Size()
+		runeStart += node.Left.RuneLength()
+		byteStart += node.Left.ByteLength()
+		if passes(node.Value.RuneLength, position) {
+			return index, node.Value, runeStart, byteStart, true
+		}
+		position -= node.Value.RuneLength
+		index++
+		runeStart += node.Value.RuneLength
+		byteStart += node.Value.ByteLength
+		node = node.Right
+	}
+	return -1, nil, 0, 0, false
+}
+
+// Finds the piece holding the nth line break, counting from 1.
+//
+// Returns index, piece, runeStartPosition, lineBreaksBefore, found
+func (t *PieceTree) FindByLineBreak(lineBreak uint) (int, *Piece, uint, uint, bool) {
+	if lineBreak == 0 || lineBreak > t.Root.LineBreaks() {
+		return -1, nil, 0, 0, false
+	}
+	var index int
+	var runeStart, lineBreaksBefore uint
+	node := t.Root
+	for node != nil {
+		if node.Left.LineBreaks() >= lineBreak {
+			node = node.Left
+			continue
+		}
+		lineBreak -= node.Left.LineBreaks()
+		index += node.Left.Size()
+		runeStart += node.Left.RuneLength()
+		lineBreaksBefore += node.Left.LineBreaks()
+		if node.Value.LineBreaks >= lineBreak {
+			return index, node.Value, runeStart, lineBreaksBefore, true
+		}
+		lineBreak -= node.Value.LineBreaks
+		index++
+		runeStart += node.Value.RuneLength
+		lineBreaksBefore += node.Value.LineBreaks
+		node = node.Right
+	}
+	return -1, nil, 0, 0, false
+}
+
+// line breaks in every piece before index
+func (t *PieceTree) LineBreaksBefore(index int) uint {
+	var lineBreaks uint
+	node := t.Root
+	for node != nil {
+		leftSize := node.Left.Size()
+		if index <= leftSize {
+			node = node.Left
+			continue
+		}
+		lineBreaks += node.Left.LineBreaks() + node.Value.LineBreaks
+		index -= leftSize + 1
+		node = node.Right
+	}
+	return lineBreaks
+}
+
+func (t *PieceTree) Forward() iter.Seq2[int, *Piece] {
+	return func(yield func(int, *Piece) bool) {
+		var i int
+		stack := make([]*TreeNode, 0)
+		node := t.Root
+		for node != nil || len(stack) > 0 {
+			for node != nil {
+				stack = append(stack, node)
+				node = node.Left
+			}
+			node = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !yield(i, node.Value) {
+				return
+			}
+			i++
+			node = node.Right
+		}
+	}
+}
+
+func (t *PieceTree) Backward() iter.Seq2[int, *Piece] {
+	return func(yield func(int, *Piece) bool) {
+		i := t.Size() - 1
+		stack := make([]*TreeNode, 0)
+		node := t.Root
+		for node != nil || len(stack) > 0 {
+			for node != nil {
+				stack = append(stack, node)
+				node = node.Right
+			}
+			node = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !yield(i, node.Value) {
+				return
+			}
+			i--
+			node = node.Left
+		}
+	}
+}
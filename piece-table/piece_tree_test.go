@@ -0,0 +1,174 @@
+package piecetable
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checks the red-black rules and that every node's sums are the ones of its subtree,
+// returns the subtree's black height
+func checkTreeNode(t *testing.T, table *PieceTable, n *TreeNode) int {
+	t.Helper()
+	if n == nil {
+		return 1
+	}
+	if isRed(n.Right) {
+		t.Fatal("a right child is red")
+	}
+	if n.red && isRed(n.Left) {
+		t.Fatal("two reds in a row")
+	}
+	left := checkTreeNode(t, table, n.Left)
+	right := checkTreeNode(t, table, n.Right)
+	if left != right {
+		t.Fatalf("black heights %d and %d", left, right)
+	}
+	piece := n.Value
+	text := table.PieceSequence(piece, piece.ByteStart, piece.ByteStart+piece.ByteLength)
+	if uint(len(text)) != piece.ByteLength || uint(text.RuneLength()) != piece.RuneLength || uint(bytes.Count(text, []byte("\n"))) != piece.LineBreaks {
+		t.Fatalf("piece %+v doesn't match its text %q", *piece, text)
+	}
+	if n.size != n.Left.Size()+n.Right.Size()+1 {
+		t.Fatalf("size %d, want %d", n.size, n.Left.Size()+n.Right.Size()+1)
+	}
+	if n.runeLength != n.Left.RuneLength()+n.Right.RuneLength()+piece.RuneLength {
+		t.Fatalf("runeLength %d, want %d", n.runeLength, n.Left.RuneLength()+n.Right.RuneLength()+piece.RuneLength)
+	}
+	if n.byteLength != n.Left.ByteLength()+n.Right.ByteLength()+piece.ByteLength {
+		t.Fatalf("byteLength %d, want %d", n.byteLength, n.Left.ByteLength()+n.Right.ByteLength()+piece.ByteLength)
+	}
+	if n.lineBreaks != n.Left.LineBreaks()+n.Right.LineBreaks()+piece.LineBreaks {
+		t.Fatalf("lineBreaks %d, want %d", n.lineBreaks, n.Left.LineBreaks()+n.Right.LineBreaks()+piece.LineBreaks)
+	}
+	if !n.red {
+		left++
+	}
+	return left
+}
+
+// the same edits on a LinkedList and a PieceTree must leave the same pieces and text
+func TestPieceTreeMatchesLinkedList(t *testing.T) {
+	alphabet := []rune("abc é\nç")
+	for seed := int64(0); seed < 300; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		original := Sequence(strings.Repeat("hello wörld\n", int(seed%4)))
+		list := NewPieceTable(original)
+		tree := NewPieceTable(original, WithPieceTree())
+		for step := 0; step < 100; step++ {
+			length := int(list.RuneLength)
+			switch choice := random.Intn(10); {
+			case choice == 0:
+				list.Undo()
+				tree.Undo()
+			case choice == 1:
+				list.Redo()
+				tree.Redo()
+			case choice < 6 || length == 0:
+				position := uint(random.Intn(length + 1))
+				text := make([]rune, 1+random.Intn(4))
+				for i := range text {
+					text[i] = alphabet[random.Intn(len(alphabet))]
+				}
+				list.Insert(position, Sequence(string(text)))
+				tree.Insert(position, Sequence(string(text)))
+			default:
+				position := random.Intn(length)
+				deleted := 1 + random.Intn(min(5, length-position))
+				list.Delete(uint(position), uint(deleted))
+				tree.Delete(uint(position), uint(deleted))
+			}
+
+			if tree.ToString() != list.ToString() {
+				t.Fatalf("seed %d step %d: tree has %q, list has %q", seed, step, tree.ToString(), list.ToString())
+			}
+			if tree.RuneLength != list.RuneLength || tree.ByteLength != list.ByteLength {
+				t.Fatalf("seed %d step %d: lengths %d/%d, list has %d/%d", seed, step, tree.RuneLength, tree.ByteLength, list.RuneLength, list.ByteLength)
+			}
+			if length := int(tree.RuneLength); length > 0 {
+				position := random.Intn(length)
+				runes := 1 + random.Intn(length-position)
+				sequence, _, err := tree.GetSequence(uint(position), uint(runes))
+				want := string([]rune(tree.ToString())[position : position+runes])
+				if err != nil || string(sequence) != want {
+					t.Fatalf("seed %d step %d: GetSequence(%d, %d) is %q, want %q (%v)", seed, step, position, runes, sequence, want, err)
+				}
+			}
+			if tree.Pieces.Size() != list.Pieces.Size() {
+				t.Fatalf("seed %d step %d: %d pieces, list has %d", seed, step, tree.Pieces.Size(), list.Pieces.Size())
+			}
+			for i, piece := range list.Pieces.Forward() {
+				treePiece, err := tree.Pieces.GetAt(i)
+				if err != nil || *treePiece != *piece {
+					t.Fatalf("seed %d step %d: piece %d is %+v, list has %+v", seed, step, i, treePiece, *piece)
+				}
+			}
+
+			root := tree.Pieces.(*PieceTree).Root
+			if isRed(root) {
+				t.Fatal("the root is red")
+			}
+			checkTreeNode(t, &tree, root)
+			if root.RuneLength() != tree.RuneLength || root.ByteLength() != tree.ByteLength {
+				t.Fatalf("seed %d step %d: root has %d runes and %d bytes, the table %d and %d", seed, step, root.RuneLength(), root.ByteLength(), tree.RuneLength, tree.ByteLength)
+			}
+			if int(root.LineBreaks()) != strings.Count(tree.ToString(), "\n") {
+				t.Fatalf("seed %d step %d: root has %d line breaks", seed, step, root.LineBreaks())
+			}
+		}
+	}
+}
+
+func TestPieceTreeBackward(t *testing.T) {
+	table := NewPieceTable(Sequence("abcdef"), WithPieceTree())
+	for i := range 20 {
+		table.Insert(uint(i*2%int(table.RuneLength)), Sequence("x"))
+	}
+	forward := []*Piece{}
+	for _, piece := range table.Pieces.Forward() {
+		forward = append(forward, piece)
+	}
+	i := len(forward) - 1
+	for _, piece := range table.Pieces.Backward() {
+		if piece != forward[i] {
+			t.Fatalf("piece %d backward isn't piece %d forward", len(forward)-1-i, i)
+		}
+		i--
+	}
+	if i != -1 {
+		t.Fatalf("backward went over %d pieces, forward over %d", len(forward)-1-i, len(forward))
+	}
+}
+
+// @benchmarks
+// Every edit creates new pieces, so the amount of edits made before
+// measuring is what makes the difference between the collections
+func benchmarkEdits(b *testing.B, options ...Option) {
+	for _, edits := range []int{100, 1000, 10000} {
+		b.Run(strconv.Itoa(edits)+"Edits", func(b *testing.B) {
+			content := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 2000)
+			table := NewPieceTable(Sequence(content), options...)
+			random := rand.New(rand.NewSource(1))
+			for range edits {
+				table.Insert(uint(random.Intn(int(table.RuneLength))), Sequence("a"))
+			}
+			b.ResetTimer()
+			for range b.N {
+				position := uint(random.Intn(int(table.RuneLength)))
+				table.Insert(position, Sequence("b"))
+				table.GetAt(position)
+				table.Delete(position, 1)
+			}
+		})
+	}
+}
+
+func BenchmarkLinkedListEdits(b *testing.B) {
+	benchmarkEdits(b)
+}
+
+func BenchmarkPieceTreeEdits(b *testing.B) {
+	benchmarkEdits(b, WithPieceTree())
+}
@@ -0,0 +1,137 @@
+package piecetable
+
+import (
+	"iter"
+	"unicode"
+)
+
+// Word boundaries for moving and deleting by word. A word is a run of letters, digits
+// and underscores (or of punctuation), spaces before it are skipped and a line break
+// is a boundary of its own, so moving by word never jumps over a whole empty line.
+
+type CharClass = int
+
+const (
+	SPACE_CHAR CharClass = iota
+	WORD_CHAR
+	PUNCTUATION_CHAR
+	LINE_BREAK_CHAR
+)
+
+// runes read at a time when walking the text, so it's never copied whole
+const RUNE_CHUNK_SIZE = 256
+
+func CharClassOf(char rune) CharClass {
+	switch {
+	case char == '\n':
+		return LINE_BREAK_CHAR
+	case unicode.IsSpace(char):
+		return SPACE_CHAR
+	// marks belong to the letter before them
+	case unicode.IsLetter(char) || unicode.IsDigit(char) || unicode.IsMark(char) || char == '_':
+		return WORD_CHAR
+	}
+	return PUNCTUATION_CHAR
+}
+
+// runes from position to the end of the text, with their positions
+func (pt *PieceTable) RunesFrom(position uint) iter.Seq2[int, rune] {
+	return func(yield func(int, rune) bool) {
+		for start := position; start < pt.RuneLength; start += RUNE_CHUNK_SIZE {
+			length := min(RUNE_CHUNK_SIZE, pt.RuneLength-start)
+			sequence, _, err := pt.GetSequence(start, length)
+			if err != nil {
+				return
+			}
+			for i, char := range sequence.RuneForward() {
+				if !yield(int(start)+i, char) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// runes before position, from the closest one to the start of the text, with their positions
+func (pt *PieceTable) RunesBefore(position uint) iter.Seq2[int, rune] {
+	return func(yield func(int, rune) bool) {
+		end := min(position, pt.RuneLength)
+		for end > 0 {
+			start := end - min(RUNE_CHUNK_SIZE, end)
+			sequence, _, err := pt.GetSequence(start, end-start)
+			if err != nil {
+				return
+			}
+			runes := make([]rune, 0, end-start)
+			for _, char := range sequence.RuneForward() {
+				runes = append(runes, char)
+			}
+			for i := len(runes) - 1; i >= 0; i-- {
+				if !yield(int(start)+i, runes[i]) {
+					return
+				}
+			}
+			end = start
+		}
+	}
+}
+
+// how many runes there are until the word boundary, runes must start next to where the walk starts
+// and forward tells which way they go. A CRLF is a single line break, the walk never stops inside it
+func wordBoundaryDistance(runes iter.Seq2[int, rune], forward bool) uint {
+	var distance uint
+	skippingSpaces := true
+	class := SPACE_CHAR
+	var previous rune
+	for _, char := range runes {
+		last := previous
+		previous = char
+		// walking back from a LF takes the CR before it too
+		if last == '\n' {
+			if char == '\r' {
+				distance++
+			}
+			break
+		}
+		charClass := CharClassOf(char)
+		if charClass == LINE_BREAK_CHAR {
+			// walking forward, the CR of a CRLF was skipped as if it was a space
+			if forward && last == '\r' {
+				if distance == 1 {
+					return 2
+				}
+				return distance - 1
+			}
+			if distance == 0 {
+				distance = 1
+				if !forward {
+					continue
+				}
+			}
+			break
+		}
+		if skippingSpaces {
+			if charClass == SPACE_CHAR {
+				distance++
+				continue
+			}
+			skippingSpaces = false
+			class = charClass
+		}
+		if charClass != class {
+			break
+		}
+		distance++
+	}
+	return distance
+}
+
+// position right after the word at or after position
+func (pt *PieceTable) NextWordEnd(position uint) uint {
+	return position + wordBoundaryDistance(pt.RunesFrom(position), true)
+}
+
+// position of the first rune of the word before position
+func (pt *PieceTable) PreviousWordStart(position uint) uint {
+	return position - wordBoundaryDistance(pt.RunesBefore(position), false)
+}
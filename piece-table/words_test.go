@@ -0,0 +1,130 @@
+package piecetable
+
+import (
+	"iter"
+	"strings"
+	"testing"
+)
+
+func TestCharClassOf(t *testing.T) {
+	cases := []struct {
+		char rune
+		want CharClass
+	}{
+		{'a', WORD_CHAR},
+		{'Z', WORD_CHAR},
+		{'7', WORD_CHAR},
+		{'_', WORD_CHAR},
+		{'ж', WORD_CHAR},
+		{'語', WORD_CHAR},
+		{'\u0663', WORD_CHAR}, // arabic-indic digit three
+		{'\u0301', WORD_CHAR}, // combining acute accent, it goes with the letter before it
+		{'\u093f', WORD_CHAR}, // devanagari vowel sign i
+		{'.', PUNCTUATION_CHAR},
+		{'-', PUNCTUATION_CHAR},
+		{'€', PUNCTUATION_CHAR},
+		{'«', PUNCTUATION_CHAR},
+		{' ', SPACE_CHAR},
+		{'\t', SPACE_CHAR},
+		{'\r', SPACE_CHAR},
+		{'\u00a0', SPACE_CHAR}, // no-break space
+		{'\u3000', SPACE_CHAR}, // ideographic space
+		{'\n', LINE_BREAK_CHAR},
+	}
+	for _, c := range cases {
+		if got := CharClassOf(c.char); got != c.want {
+			t.Errorf("CharClassOf(%q) is %d, want %d", c.char, got, c.want)
+		}
+	}
+}
+
+func TestWordBoundaries(t *testing.T) {
+	long := strings.Repeat("a", 3*RUNE_CHUNK_SIZE+10)
+	spaces := strings.Repeat(" ", RUNE_CHUNK_SIZE+1)
+	cases := []struct {
+		name     string
+		text     string
+		position uint
+		next     uint // NextWordEnd(position)
+		previous uint // PreviousWordStart(position)
+	}{
+		{"start of the text", "hello world", 0, 5, 0},
+		{"end of the text", "hello world", 11, 11, 6},
+		{"inside a word", "hello world", 2, 5, 0},
+		{"spaces before the word", "hello   world", 5, 13, 0},
+		{"spaces after the word", "hello   world", 8, 13, 0},
+		{"letters, digits and underscores", "x1_y2 z", 0, 5, 0},
+		{"punctuation after a word", "foo.bar", 3, 4, 0},
+		{"a word after punctuation", "foo.bar", 4, 7, 3},
+		{"a run of punctuation", "a+=b", 1, 3, 0},
+		{"cyrillic", "привет мир", 7, 10, 0},
+		{"cjk", "日本語 テキスト", 3, 8, 0},
+		{"combining marks", "e\u0301te\u0301 x", 0, 5, 0},
+		{"a combining mark on the last letter", "ab e\u0301", 5, 5, 3},
+		{"before a line break", "ab\ncd", 2, 3, 0},
+		{"after a line break", "ab\ncd", 3, 5, 2},
+		{"an empty line", "a\n\nb", 2, 3, 1},
+		{"a word longer than a chunk", long + " b", 0, uint(len(long)), 0},
+		{"back over a word longer than a chunk", long + " b", uint(len(long)), uint(len(long)) + 2, 0},
+		{"spaces longer than a chunk", "x" + spaces + "y", 1, uint(len(spaces)) + 2, 0},
+		{"a chunk boundary inside the word", long, RUNE_CHUNK_SIZE, uint(len(long)), 0},
+	}
+	for _, collection := range collections {
+		for _, c := range cases {
+			table := NewPieceTable(Sequence(c.text), collection.options...)
+			if got := table.NextWordEnd(c.position); got != c.next {
+				t.Errorf("%s, %s: NextWordEnd(%d) is %d, want %d", collection.name, c.name, c.position, got, c.next)
+			}
+			if got := table.PreviousWordStart(c.position); got != c.previous {
+				t.Errorf("%s, %s: PreviousWordStart(%d) is %d, want %d", collection.name, c.name, c.position, got, c.previous)
+			}
+		}
+	}
+}
+
+// the runes of text in the order the walk reads them
+func walk(text string, forward bool) iter.Seq2[int, rune] {
+	runes := []rune(text)
+	return func(yield func(int, rune) bool) {
+		for i := range runes {
+			if !forward {
+				i = len(runes) - 1 - i
+			}
+			if !yield(i, runes[i]) {
+				return
+			}
+		}
+	}
+}
+
+func TestWordBoundaryDistance(t *testing.T) {
+	cases := []struct {
+		runes   string
+		forward bool
+		want    uint
+	}{
+		{"", true, 0},
+		{"", false, 0},
+		{"abc def", true, 3},
+		{"abc def", false, 3},
+		{"  abc", true, 5},
+		{"abc  ", false, 5},
+		{"ab.cd", true, 2},
+		{"ab.cd", false, 2},
+		{"...ab", true, 3},
+		{"\nab", true, 1},
+		{"ab\n", false, 1},
+		{"a\nb", true, 1},
+		{"a\nb", false, 1},
+		{"\r\nab", true, 2},  // a CRLF is a single break
+		{"ab\r\n", false, 2}, // the same walking back from the LF
+		{"  \r\nab", true, 2},
+		{"ab\r\n  ", false, 2},
+		{"ab\r", true, 2}, // a lone CR is a space
+	}
+	for _, c := range cases {
+		if got := wordBoundaryDistance(walk(c.runes, c.forward), c.forward); got != c.want {
+			t.Errorf("wordBoundaryDistance(%q, forward %v) is %d, want %d", c.runes, c.forward, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// A theme has every color the editor draws with. Besides dark and light, themes can be json files in
+// the themes directory inside the config directory, named after the file, like themes/solarized.json
+//
+//	{
+//		"background": "#002b36",
+//		"text": "#839496",
+//		"tokens": {"keyword": "#859900"}
+//	}
+//
+// Colors that are missing are taken from the dark theme.
+
+// @colors
+// a color written as "#rrggbb" or "#rrggbbaa"
+type Color rl.Color
+
+func (c *Color) UnmarshalJSON(data []byte) error {
+	var text string
+	err := json.Unmarshal(data, &text)
+	if err != nil {
+		return err
+	}
+	color, err := ParseColor(text)
+	if err != nil {
+		return err
+	}
+	*c = color
+	return nil
+}
+
+func (c Color) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.String())
+}
+
+func (c Color) String() string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
+
+func ParseColor(text string) (Color, error) {
+	digits, ok := strings.CutPrefix(text, "#")
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if !ok || err != nil || len(digits) != 6 && len(digits) != 8 {
+		return Color{}, fmt.Errorf("ParseColor: %q isn't a color like #rrggbb or #rrggbbaa", text)
+	}
+	if len(digits) == 6 {
+		value = value<<8 | 0xff
+	}
+	return Color{R: uint8(value >> 24), G: uint8(value >> 16), B: uint8(value >> 8), A: uint8(value)}, nil
+}
+
+// for the colors written in the code, which are known to be right
+func mustColor(text string) Color {
+	color, err := ParseColor(text)
+	if err != nil {
+		panic(err)
+	}
+	return color
+}
+
+// @themes
+// the kinds of token a syntax highlighter can color, nothing highlights the text yet
+var TOKEN_KINDS = []string{"keyword", "string", "comment", "number", "type", "function", "operator"}
+
+type Theme struct {
+	Name              string           `json:"-"`
+	Background        Color            `json:"background"`
+	Text              Color            `json:"text"`
+	Gutter            Color            `json:"gutter"` // behind the line numbers
+	LineNumber        Color            `json:"lineNumber"`
+	CurrentLineNumber Color            `json:"currentLineNumber"`
+	CurrentLine       Color            `json:"currentLine"` // drawn over the text, so it should be translucent
+	Cursor            Color            `json:"cursor"`
+	Selection         Color            `json:"selection"`
+	Scrollbar         Color            `json:"scrollbar"`
+	ScrollbarThumb    Color            `json:"scrollbarThumb"`
+	Panel             Color            `json:"panel"` // behind the prompt and the messages
+	PanelText         Color            `json:"panelText"`
+	Debug             Color            `json:"debug"`
+	Tokens            map[string]Color `json:"tokens"` // by token kind, see TOKEN_KINDS
+}
+
+var DARK_THEME = Theme{
+	Name:              "dark",
+	Background:        mustColor("#1e1e1e"),
+	Text:              mustColor("#ffffff"),
+	Gutter:            mustColor("#1e1e1e"),
+	LineNumber:        mustColor("#5a5a5a"),
+	CurrentLineNumber: mustColor("#ffffff"),
+	CurrentLine:       mustColor("#ffffff0a"),
+	Cursor:            mustColor("#ffffff"),
+	Selection:         mustColor("#264f78"),
+	Scrollbar:         mustColor("#ffffff14"),
+	ScrollbarThumb:    mustColor("#ffffff50"),
+	Panel:             mustColor("#323232"),
+	PanelText:         mustColor("#ffffff"),
+	Debug:             mustColor("#ff6dc2"),
+	Tokens: map[string]Color{
+		"keyword":  mustColor("#569cd6"),
+		"string":   mustColor("#ce9178"),
+		"comment":  mustColor("#6a9955"),
+		"number":   mustColor("#b5cea8"),
+		"type":     mustColor("#4ec9b0"),
+		"function": mustColor("#dcdcaa"),
+		"operator": mustColor("#d4d4d4"),
+	},
+}
+
+var LIGHT_THEME = Theme{
+	Name:              "light",
+	Background:        mustColor("#fafafa"),
+	Text:              mustColor("#383a42"),
+	Gutter:            mustColor("#fafafa"),
+	LineNumber:        mustColor("#9d9d9f"),
+	CurrentLineNumber: mustColor("#383a42"),
+	CurrentLine:       mustColor("#0000000a"),
+	Cursor:            mustColor("#526fff"),
+	Selection:         mustColor("#c8d7ff"),
+	Scrollbar:         mustColor("#00000014"),
+	ScrollbarThumb:    mustColor("#00000050"),
+	Panel:             mustColor("#e5e5e6"),
+	PanelText:         mustColor("#383a42"),
+	Debug:             mustColor("#d6336c"),
+	Tokens: map[string]Color{
+		"keyword":  mustColor("#a626a4"),
+		"string":   mustColor("#50a14f"),
+		"comment":  mustColor("#a0a1a7"),
+		"number":   mustColor("#986801"),
+		"type":     mustColor("#c18401"),
+		"function": mustColor("#4078f2"),
+		"operator": mustColor("#383a42"),
+	},
+}
+
+var BUILTIN_THEMES = []Theme{DARK_THEME, LIGHT_THEME}
+
+// the color for a kind of token, the text's color when the theme doesn't have one
+func (t Theme) TokenColor(kind string) rl.Color {
+	color, ok := t.Tokens[kind]
+	if !ok {
+		return rl.Color(t.Text)
+	}
+	return rl.Color(color)
+}
+
+// Reads a theme file on top of the dark theme, it's named after the file
+func LoadTheme(path string) (Theme, error) {
+	theme := DARK_THEME
+	theme.Tokens = maps.Clone(DARK_THEME.Tokens)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Theme{}, fmt.Errorf("LoadTheme: error trying to read %s: %w", path, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&theme)
+	if err != nil {
+		return Theme{}, fmt.Errorf("LoadTheme: error trying to parse %s: %w", path, err)
+	}
+	var errs []error
+	for kind := range theme.Tokens {
+		if !slices.Contains(TOKEN_KINDS, kind) {
+			errs = append(errs, fmt.Errorf("LoadTheme: unknown token kind %q in %s", kind, path))
+			delete(theme.Tokens, kind)
+		}
+	}
+	theme.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return theme, errors.Join(errs...)
+}
+
+// Finds a theme by name, first the builtin ones and then the files in dir.
+// A name with a path separator or a .json extension is a path to the theme file
+func FindTheme(name string, dir string) (Theme, error) {
+	if strings.ContainsRune(name, os.PathSeparator) || strings.ContainsRune(name, '/') || filepath.Ext(name) == ".json" {
+		return LoadTheme(name)
+	}
+	for _, theme := range BUILTIN_THEMES {
+		if strings.EqualFold(theme.Name, name) {
+			return theme, nil
+		}
+	}
+	if dir == "" {
+		return Theme{}, fmt.Errorf("FindTheme: unknown theme %q", name)
+	}
+	theme, err := LoadTheme(filepath.Join(dir, name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Theme{}, fmt.Errorf("FindTheme: unknown theme %q", name)
+	}
+	return theme, err
+}
+
+// the builtin themes and then the ones in dir, sorted
+func ThemeNames(dir string) []string {
+	names := []string{}
+	for _, theme := range BUILTIN_THEMES {
+		names = append(names, theme.Name)
+	}
+	if dir == "" {
+		return names
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	custom := []string{}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		if !slices.Contains(names, name) {
+			custom = append(custom, name)
+		}
+	}
+	slices.Sort(custom)
+	return append(names, custom...)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	cases := []struct {
+		text  string
+		want  Color
+		valid bool
+	}{
+		{"#000000", Color{0, 0, 0, 255}, true},
+		{"#ffffff", Color{255, 255, 255, 255}, true},
+		{"#264f78", Color{0x26, 0x4f, 0x78, 255}, true},
+		{"#264F78", Color{0x26, 0x4f, 0x78, 255}, true},
+		{"#ffffff0a", Color{255, 255, 255, 0x0a}, true},
+		{"#00000000", Color{0, 0, 0, 0}, true},
+		{"", Color{}, false},
+		{"#", Color{}, false},
+		{"ffffff", Color{}, false}, // without the #
+		{"#fff", Color{}, false},   // the short form isn't read
+		{"#fffffff", Color{}, false},
+		{"#fffffffff", Color{}, false},
+		{"#gggggg", Color{}, false},
+		{"#+fffff", Color{}, false},
+		{" #ffffff", Color{}, false},
+	}
+	for _, c := range cases {
+		got, err := ParseColor(c.text)
+		if c.valid && err != nil {
+			t.Errorf("ParseColor(%q): %v", c.text, err)
+			continue
+		}
+		if !c.valid && err == nil {
+			t.Errorf("ParseColor(%q) is %v, want an error", c.text, got)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseColor(%q) is %v, want %v", c.text, got, c.want)
+		}
+		// a color is written back in a form that reads as the same color
+		if again, _ := ParseColor(got.String()); again != got {
+			t.Errorf("%v is written as %q, which reads as %v", got, got.String(), again)
+		}
+	}
+}
+
+func TestFindTheme(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"solarized.json": `{"background": "#002b36", "tokens": {"keyword": "#859900"}}`,
+		"broken.json":    `{"background": "#002b36"`,
+		"badcolor.json":  `{"text": "blue"}`,
+		"unknown.json":   `{"foreground": "#002b36"}`,
+		"tokens.json":    `{"tokens": {"keyword": "#859900", "macro": "#ff0000"}}`,
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	solarized := DARK_THEME
+	solarized.Name = "solarized"
+	solarized.Background = mustColor("#002b36")
+	solarized.Tokens = maps.Clone(DARK_THEME.Tokens)
+	solarized.Tokens["keyword"] = mustColor("#859900")
+
+	cases := []struct {
+		name  string
+		dir   string
+		want  Theme // the theme's name and a few of its colors are checked
+		valid bool
+	}{
+		{"dark", dir, DARK_THEME, true},
+		{"Light", dir, LIGHT_THEME, true}, // builtin names are found in any case
+		{"solarized", dir, solarized, true},
+		{filepath.Join(dir, "solarized.json"), "", solarized, true}, // a path doesn't need the directory
+		{"solarized", "", Theme{}, false},
+		{"missing", dir, Theme{}, false},
+		{"broken", dir, Theme{}, false},
+		{"badcolor", dir, Theme{}, false},
+		{"unknown", dir, Theme{}, false}, // unknown fields are mistakes, not ignored
+		{"missing.json", dir, Theme{}, false},
+	}
+	for _, c := range cases {
+		got, err := FindTheme(c.name, c.dir)
+		if c.valid && err != nil {
+			t.Errorf("FindTheme(%q): %v", c.name, err)
+			continue
+		}
+		if !c.valid && err == nil {
+			t.Errorf("FindTheme(%q) found %q, want an error", c.name, got.Name)
+			continue
+		}
+		if got.Name != c.want.Name || got.Background != c.want.Background || got.Text != c.want.Text ||
+			got.TokenColor("keyword") != c.want.TokenColor("keyword") {
+			t.Errorf("FindTheme(%q) is %+v, want %+v", c.name, got, c.want)
+		}
+	}
+
+	// an unknown token kind is an error, but the rest of the theme is still used
+	got, err := FindTheme("tokens", dir)
+	if err == nil {
+		t.Error("an unknown token kind isn't an error")
+	}
+	if got.Name != "tokens" || got.TokenColor("keyword") != solarized.TokenColor("keyword") {
+		t.Errorf("the theme with an unknown token kind is %+v", got)
+	}
+	if _, ok := got.Tokens["macro"]; ok {
+		t.Error("the unknown token kind was kept")
+	}
+}
@@ -1,30 +1,67 @@
 package utils
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 )
 
 var Logger = log.New(os.Stdout, "\033[33m[DEBUG]\033[0m ", 0)
 
-func ReadFile(path string) ([]byte, int) {
-	file, err := os.Open(path)
+// Reads the file exactly as it is on disk, line endings, a missing final line break
+// and invalid UTF-8 included, so saving it back writes the same bytes.
+//
+// bytes, lines, error
+func ReadFile(path string) ([]byte, int, error) {
+	content, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, 0, err
+	}
+	lines := bytes.Count(content, []byte{'\n'})
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		lines++
+	}
+	return content, lines, nil
+}
+
+// Writes data to a temporary file next to path and renames it over path, so a crash
+// in the middle of the write never leaves a half written file behind.
+// The permissions of the file being replaced are kept, new files get 0644
+func WriteFileAtomic(path string, data []byte) error {
+	perm := os.FileMode(0644)
+	info, err := os.Stat(path)
+	if err == nil {
+		perm = info.Mode().Perm()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	bytes := make([]byte, 0)
-	i := 0
-	for scanner.Scan() {
-		bytes = append(bytes, scanner.Bytes()...)
-		bytes = append(bytes, '\n')
-		i++
-	}
-	return bytes, i
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	// after the rename there's nothing to remove, so the error is ignored
+	defer os.Remove(tempPath)
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
 }
 
 func IntToString(num int) string {